@@ -0,0 +1,25 @@
+// Command masstub serves the bundled MAS fixtures over http, for running the
+// bot offline with MAS_BASE_URL="http://localhost:8056".
+package main
+
+import (
+	"flag"
+	"net/http"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/masstub"
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	addr := flag.String("addr", ":8056", "address to listen on")
+	shift := flag.Bool("shift", true, "shift the fixtures so the latest issue is next month's")
+	flag.Parse()
+
+	fixtures := masstub.DefaultFixtures()
+	if *shift {
+		fixtures = fixtures.ShiftTo(time.Now().AddDate(0, 1, 0))
+	}
+	log.Infof("serving %v bonds from masstub on %v", len(fixtures.Bonds), *addr)
+	log.Fatal(http.ListenAndServe(*addr, masstub.NewServer(fixtures)))
+}
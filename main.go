@@ -1,10 +1,19 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"net/url"
+	"os/signal"
+	"syscall"
+	"time"
+
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 
 	"github.com/Jason-CKY/telegram-ssbbot/pkg/core"
 	"github.com/Jason-CKY/telegram-ssbbot/pkg/handler"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/metrics"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/repository"
 	"github.com/Jason-CKY/telegram-ssbbot/pkg/utils"
 	"github.com/joho/godotenv"
 	log "github.com/sirupsen/logrus"
@@ -19,10 +28,38 @@ func main() {
 	}
 
 	utils.LogLevel = utils.LookupEnvString("LOG_LEVEL")
-	utils.DirectusHost = utils.LookupEnvString("DIRECTUS_HOST")
-	utils.DirectusToken = utils.LookupEnvString("DIRECTUS_TOKEN")
+	utils.StorageBackend = utils.LookupEnvStringDefault("STORAGE_BACKEND", utils.STORAGE_BACKEND_DIRECTUS)
+	switch utils.StorageBackend {
+	case utils.STORAGE_BACKEND_DIRECTUS:
+		utils.DirectusHost = utils.LookupEnvString("DIRECTUS_HOST")
+		utils.DirectusToken = utils.LookupEnvString("DIRECTUS_TOKEN")
+	case utils.STORAGE_BACKEND_SQLITE:
+		utils.SQLitePath = utils.LookupEnvStringDefault("SQLITE_PATH", "ssbbot.db")
+	}
 	utils.BotToken = utils.LookupEnvString(("TELEGRAM_BOT_TOKEN"))
 	utils.WhitelistedUsernames = utils.LookupEnvStringArray("ALLOWED_USERNAMES")
+	utils.MASBaseURL = utils.LookupEnvStringDefault("MAS_BASE_URL", utils.DEFAULT_MAS_BASE_URL)
+	utils.MASUserAgent = utils.LookupEnvStringDefault("MAS_USER_AGENT", utils.DEFAULT_MAS_USER_AGENT)
+	utils.MASTimeout = utils.LookupEnvIntDefault("MAS_TIMEOUT_SECONDS", 30)
+	utils.MASCacheTTL = utils.LookupEnvIntDefault("MAS_CACHE_TTL_MINUTES", 60)
+	utils.BroadcastWorkers = utils.LookupEnvIntDefault("BROADCAST_WORKERS", 8)
+	utils.TelegramGlobalRate = utils.LookupEnvIntDefault("TELEGRAM_GLOBAL_RATE_PER_SECOND", 30)
+	utils.TelegramGroupRate = utils.LookupEnvIntDefault("TELEGRAM_GROUP_RATE_PER_MINUTE", 20)
+	utils.ShutdownTimeout = utils.LookupEnvIntDefault("SHUTDOWN_TIMEOUT_SECONDS", 30)
+	utils.ScheduleFile = utils.LookupEnvStringDefault("SCHEDULE_FILE", "")
+	utils.AnnouncementSchedule = utils.LookupEnvStringDefault("ANNOUNCEMENT_SCHEDULE", core.DefaultJobSchedules.Announcement)
+	utils.MaintenanceSchedule = utils.LookupEnvStringDefault("MAINTENANCE_SCHEDULE", core.DefaultJobSchedules.Maintenance)
+	utils.ReminderSchedule = utils.LookupEnvStringDefault("REMINDER_SCHEDULE", core.DefaultJobSchedules.Reminders)
+	utils.AllotmentSchedule = utils.LookupEnvStringDefault("ALLOTMENT_SCHEDULE", core.DefaultJobSchedules.Allotment)
+	utils.PayoutSchedule = utils.LookupEnvStringDefault("PAYOUT_SCHEDULE", core.DefaultJobSchedules.Payouts)
+	utils.HealthListenAddr = utils.LookupEnvStringDefault("HEALTH_LISTEN_ADDR", ":9090")
+	utils.NotifyCouponCurve = utils.LookupEnvBoolDefault("NOTIFY_COUPON_CURVE", false)
+	utils.UpdateMode = utils.LookupEnvStringDefault("UPDATE_MODE", utils.UPDATE_MODE_POLLING)
+	if utils.UpdateMode == utils.UPDATE_MODE_WEBHOOK {
+		utils.WebhookURL = utils.LookupEnvString("WEBHOOK_URL")
+		utils.WebhookListenAddr = utils.LookupEnvStringDefault("WEBHOOK_LISTEN_ADDR", ":8080")
+		utils.WebhookSecretToken = utils.LookupEnvString("WEBHOOK_SECRET_TOKEN")
+	}
 
 	// setup logrus
 	log.SetReportCaller(true)
@@ -43,13 +80,159 @@ func main() {
 		panic(err)
 	}
 
-	go core.ScheduleUpdate(bot)
+	localTimezone, err := time.LoadLocation(utils.DEFAULT_TIMEZONE)
+	if err != nil {
+		panic(err)
+	}
+	masHTTPClient := core.NewMASClient(core.MASClientConfig{
+		BaseURL:   utils.MASBaseURL,
+		Timeout:   time.Duration(utils.MASTimeout) * time.Second,
+		UserAgent: utils.MASUserAgent,
+	})
+	masClient := core.NewCachedMASClient(masHTTPClient, core.CachedMASClientConfig{
+		ListBondsTTL: time.Duration(utils.MASCacheTTL) * time.Minute,
+		// interest rates of an issue do not change once announced
+		BondInterestTTL: 24 * time.Hour,
+		Timezone:        localTimezone,
+	})
+
+	notifier := core.NewNotifier(masClient, localTimezone, utils.NotifyCouponCurve)
+
+	repo, err := repository.NewRepository(utils.StorageBackend)
+	if err != nil {
+		panic(err)
+	}
+
+	metrics.RegisterSubscriberCount(repo.CountSubscribers)
+
+	rateLimiter, err := core.NewRateLimiter(core.RateLimiterConfig{
+		GlobalPerSecond: float64(utils.TelegramGlobalRate),
+		GroupPerMinute:  float64(utils.TelegramGroupRate),
+	})
+	if err != nil {
+		panic(err)
+	}
+	sender := core.NewSubscriptionSender(core.NewRateLimitedSender(bot, rateLimiter), repo)
+
+	schedules := core.JobSchedules{
+		Announcement: utils.AnnouncementSchedule,
+		Maintenance:  utils.MaintenanceSchedule,
+		Reminders:    utils.ReminderSchedule,
+		Allotment:    utils.AllotmentSchedule,
+		Payouts:      utils.PayoutSchedule,
+	}
+	if utils.ScheduleFile != "" {
+		schedules, err = core.LoadJobSchedules(utils.ScheduleFile, schedules)
+		if err != nil {
+			panic(err)
+		}
+	}
+	scheduler := &core.Scheduler{
+		Sender:      sender,
+		Repository:  repo,
+		MASClient:   masClient,
+		Notifier:    notifier,
+		Broadcaster: core.NewBroadcaster(utils.BroadcastWorkers),
+		Timezone:    localTimezone,
+		Schedules:   schedules,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	shutdownTimeout := time.Duration(utils.ShutdownTimeout) * time.Second
 
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
-	updates := bot.GetUpdatesChan(u)
-	for update := range updates {
-		handler.HandleUpdate(&update, bot)
+	schedulerDone := make(chan struct{})
+	go func() {
+		defer close(schedulerDone)
+		if err := scheduler.Run(ctx, shutdownTimeout); err != nil {
+			panic(err)
+		}
+	}()
+
+	healthDone := make(chan struct{})
+	if utils.HealthListenAddr != "" {
+		go func() {
+			defer close(healthDone)
+			checks := map[string]handler.ReadinessCheck{
+				utils.StorageBackend: repo.Ping,
+			}
+			// commands not needing MAS are still answered while it is down
+			optional := map[string]handler.ReadinessCheck{
+				"mas": masHTTPClient.Ping,
+			}
+			if err := handler.ListenForHealth(ctx, utils.HealthListenAddr, checks, optional, shutdownTimeout); err != nil {
+				panic(err)
+			}
+		}()
+	} else {
+		close(healthDone)
+	}
+
+	var updates tgbotapi.UpdatesChannel
+	var webhookHandler *handler.WebhookHandler
+	webhookDone := make(chan struct{})
+	switch utils.UpdateMode {
+	case utils.UPDATE_MODE_WEBHOOK:
+		webhookURL, err := url.Parse(utils.WebhookURL)
+		if err != nil {
+			panic(err)
+		}
+		webhookPath := webhookURL.Path
+		if webhookPath == "" {
+			webhookPath = "/"
+		}
+		webhookHandler, err = handler.NewWebhookHandler(utils.WebhookSecretToken, bot.Buffer)
+		if err != nil {
+			panic(err)
+		}
+		updates = webhookHandler.Updates()
+		go func() {
+			defer close(webhookDone)
+			if err := handler.ListenForWebhook(ctx, utils.WebhookListenAddr, webhookPath, webhookHandler, shutdownTimeout); err != nil {
+				panic(err)
+			}
+		}()
+		if err := handler.SetWebhook(bot, utils.WebhookURL, utils.WebhookSecretToken); err != nil {
+			panic(err)
+		}
+	case utils.UPDATE_MODE_POLLING:
+		// telegram rejects getUpdates while a webhook is set
+		if err := handler.DeleteWebhook(bot); err != nil {
+			panic(err)
+		}
+		u := tgbotapi.NewUpdate(0)
+		u.Timeout = 60
+		updates = bot.GetUpdatesChan(u)
+	default:
+		panic(fmt.Errorf("unknown update mode %v", utils.UpdateMode))
+	}
+	// an update being handled when the signal arrives is allowed to finish
+	handlerCtx := context.WithoutCancel(ctx)
+updatesLoop:
+	for {
+		select {
+		case <-ctx.Done():
+			break updatesLoop
+		case update := <-updates:
+			handler.HandleUpdate(handlerCtx, &update, sender, repo, masClient, notifier, localTimezone)
+		}
+	}
+
+	log.Info("shutting down")
+	if utils.UpdateMode == utils.UPDATE_MODE_WEBHOOK {
+		<-webhookDone
+		webhookHandler.Drain(func(update tgbotapi.Update) {
+			handler.HandleUpdate(handlerCtx, &update, sender, repo, masClient, notifier, localTimezone)
+		})
+		if err := handler.DeleteWebhook(bot); err != nil {
+			log.Error(err)
+		}
+	} else {
+		bot.StopReceivingUpdates()
+	}
+	<-schedulerDone
+	<-healthDone
+	if err := repo.Close(); err != nil {
+		log.Error(err)
 	}
 
 }
@@ -0,0 +1,149 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+	log "github.com/sirupsen/logrus"
+)
+
+// allotmentResultsWindow is how long after the tender date allotment results
+// are still sent, so chats subscribing later are not sent stale results.
+const allotmentResultsWindow = 14 * 24 * time.Hour
+
+// AllotmentExampleAmounts are the application sizes the allotment results
+// notification works out the allotment of.
+var AllotmentExampleAmounts = []float64{10_000, 50_000, 100_000, 200_000}
+
+// LatestAllotment returns the most recent bond MAS has published allotment
+// results of, or nil if there are none yet.
+func LatestAllotment(ctx context.Context, masClient MASClient, localTimezone *time.Location) (*schemas.SavingsBonds, error) {
+	now := time.Now().In(localTimezone)
+	bondsPtr, err := masClient.ListBonds(ctx, now.AddDate(0, -2, 0), now.AddDate(0, 2, 0), 3)
+	if err != nil {
+		return nil, err
+	}
+	for _, bond := range *bondsPtr {
+		// allotted amounts are zero until the results are published
+		if bond.AmountAlloted > 0 {
+			return &bond, nil
+		}
+	}
+	return nil, nil
+}
+
+// Allotment returns what an application of applied dollars was allotted: all
+// of it up to the cut-off amount, and above it the cut-off amount plus, for
+// the randomly drawn share of applicants, the random allotment amount.
+func Allotment(bond schemas.SavingsBonds, applied float64) (allotted float64, drawnAllotted float64) {
+	if bond.CutoffAmount == 0 || applied <= bond.CutoffAmount {
+		return applied, applied
+	}
+	return bond.CutoffAmount, bond.CutoffAmount + min(bond.RandomAllotedAmount, applied-bond.CutoffAmount)
+}
+
+// FormatDollars formats an amount in dollars with thousands separators, and
+// cents only if there are any, e.g. "S$30,000" or "S$1,432.50".
+func FormatDollars(amount float64) string {
+	cents := int64(math.Round(math.Abs(amount) * 100))
+	digits := strconv.FormatInt(cents/100, 10)
+	var b strings.Builder
+	if amount < 0 {
+		b.WriteByte('-')
+	}
+	b.WriteString("S$")
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(digit)
+	}
+	if cents%100 != 0 {
+		fmt.Fprintf(&b, ".%02d", cents%100)
+	}
+	return b.String()
+}
+
+// FormatAllotmentResults returns the MarkdownV2 summary of the allotment
+// results of bond.
+func FormatAllotmentResults(bond schemas.SavingsBonds) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "📊 *Allotment Results \\(%s\\)* 📊\n\n", bond.IssueCode)
+	fmt.Fprintf(&b, "*Issue Size:* %.2f Million SGD\n", bond.IssueSize)
+	fmt.Fprintf(&b, "*Amount Applied:* %.2f Million SGD\n", bond.AmountApplied)
+	fmt.Fprintf(&b, "*Amount Allotted:* %.2f Million SGD\n", bond.AmountAlloted)
+	if bond.AmountApplied <= bond.AmountAlloted || bond.CutoffAmount == 0 {
+		b.WriteString("\nThe issue was not oversubscribed, every application was allotted in full.\n")
+	} else {
+		writeOversubscribedAllotment(&b, bond)
+	}
+	return strings.Replace(b.String(), ".", "\\.", -1)
+}
+
+func writeOversubscribedAllotment(b *strings.Builder, bond schemas.SavingsBonds) {
+	fmt.Fprintf(b, "*Oversubscription:* %.2fx\n", bond.AmountApplied/bond.IssueSize)
+	fmt.Fprintf(b, "*Cut\\-off Amount:* %s\n", FormatDollars(bond.CutoffAmount))
+	if bond.RandomAllotedAmount > 0 {
+		fmt.Fprintf(b, "*Random Allotment:* %s more to %.0f%% of applicants above the cut\\-off\n", FormatDollars(bond.RandomAllotedAmount), bond.RandomAllotedRate)
+	}
+
+	b.WriteString("\n*If you applied for:*\n")
+	for _, applied := range AllotmentExampleAmounts {
+		allotted, drawnAllotted := Allotment(bond, applied)
+		switch {
+		case allotted == applied:
+			fmt.Fprintf(b, "\\- %s: allotted in full\n", FormatDollars(applied))
+		case drawnAllotted > allotted:
+			fmt.Fprintf(b, "\\- %s: %s, or %s if drawn \\(%.0f%% chance\\)\n", FormatDollars(applied), FormatDollars(allotted), FormatDollars(drawnAllotted), bond.RandomAllotedRate)
+		default:
+			fmt.Fprintf(b, "\\- %s: %s\n", FormatDollars(applied), FormatDollars(allotted))
+		}
+	}
+}
+
+// NotifyAllotment sends the allotment results of the latest tendered issue
+// to every subscribed chat, once per issue, for a while after the tender.
+func (s *Scheduler) NotifyAllotment(ctx context.Context) error {
+	var bond *schemas.SavingsBonds
+	err := Retry(ctx, DefaultRetryPolicy, "get latest allotment", func() (err error) {
+		bond, err = LatestAllotment(ctx, s.MASClient, s.Timezone)
+		return err
+	})
+	if err != nil || bond == nil {
+		return err
+	}
+	if tenderDate := time.Time(bond.TenderDate); !tenderDate.IsZero() && time.Since(tenderDate) > allotmentResultsWindow {
+		return nil
+	}
+
+	issueCode := bond.IssueCode
+	var chats []schemas.ChatSettings
+	err = Retry(ctx, DefaultRetryPolicy, "get users to notify of allotment", func() (err error) {
+		chats, err = s.Repository.GetUsersToNotifyAllotment(ctx, issueCode)
+		return err
+	})
+	if err != nil || len(chats) == 0 {
+		return err
+	}
+	chatIds := make([]int64, len(chats))
+	for i, chat := range chats {
+		chatIds[i] = chat.ChatId
+	}
+
+	results := FormatAllotmentResults(*bond)
+	log.Infof("sending allotment results of %v to %v chats", issueCode, len(chatIds))
+	s.Broadcaster.Broadcast(ctx, chatIds, func(chatId int64) {
+		err := s.sendMessageToChat(ctx, chatId, results, func(chatSettings *schemas.ChatSettings) {
+			chatSettings.LatestSSBAllotmentNotified = issueCode
+		})
+		if err != nil {
+			log.Errorf("error sending allotment results of %v to chat %v (%v): %v", issueCode, chatId, ClassifyTelegramError(err), err)
+		}
+	})
+	return nil
+}
@@ -0,0 +1,49 @@
+package core_test
+
+import (
+	"testing"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/core"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+)
+
+func TestAllotment(t *testing.T) {
+	bond := schemas.SavingsBonds{CutoffAmount: 20_000, RandomAllotedAmount: 500}
+	for _, tc := range []struct {
+		applied, wantAllotted, wantDrawnAllotted float64
+	}{
+		{10_000, 10_000, 10_000},
+		{20_000, 20_000, 20_000},
+		{20_500, 20_000, 20_500},
+		{50_000, 20_000, 20_500},
+	} {
+		allotted, drawnAllotted := core.Allotment(bond, tc.applied)
+		if allotted != tc.wantAllotted || drawnAllotted != tc.wantDrawnAllotted {
+			t.Errorf("applying %v was allotted %v or %v if drawn, want %v or %v", tc.applied, allotted, drawnAllotted, tc.wantAllotted, tc.wantDrawnAllotted)
+		}
+	}
+
+	// an issue that is not oversubscribed has no cut-off amount
+	if allotted, drawnAllotted := core.Allotment(schemas.SavingsBonds{}, 50_000); allotted != 50_000 || drawnAllotted != 50_000 {
+		t.Errorf("applying 50000 to an undersubscribed issue was allotted %v or %v if drawn", allotted, drawnAllotted)
+	}
+}
+
+func TestFormatDollars(t *testing.T) {
+	for _, tc := range []struct {
+		amount float64
+		want   string
+	}{
+		{0, "S$0"},
+		{500, "S$500"},
+		{30_000, "S$30,000"},
+		{1_432.5, "S$1,432.50"},
+		{200_000.004, "S$200,000"},
+		{1_234_567.891, "S$1,234,567.89"},
+		{-5_000, "-S$5,000"},
+	} {
+		if got := core.FormatDollars(tc.amount); got != tc.want {
+			t.Errorf("FormatDollars(%v) = %q, want %q", tc.amount, got, tc.want)
+		}
+	}
+}
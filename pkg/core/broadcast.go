@@ -0,0 +1,194 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+// tokenBucket allows rate events per second on average, with bursts of up to burst events.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+// reserve takes n tokens and returns how long to wait before they may be used.
+func (b *tokenBucket) reserve(now time.Time, n int) time.Duration {
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// idle reports whether the bucket has refilled by now, so it would behave the
+// same as a new bucket.
+func (b *tokenBucket) idle(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+// groupSweepInterval is how often idle group buckets are dropped.
+const groupSweepInterval = 10 * time.Minute
+
+type RateLimiterConfig struct {
+	GlobalPerSecond float64 // telegram allows about 30 messages per second in total
+	GroupPerMinute  float64 // and about 20 messages per minute to the same group
+}
+
+// RateLimiter spaces out messages to stay within telegram's flood limits, and
+// pauses every message when telegram asks to retry after some time.
+type RateLimiter struct {
+	config RateLimiterConfig
+
+	mu          sync.Mutex
+	global      *tokenBucket
+	groups      map[int64]*tokenBucket
+	lastSweep   time.Time
+	pausedUntil time.Time
+}
+
+func NewRateLimiter(config RateLimiterConfig) (*RateLimiter, error) {
+	if config.GlobalPerSecond <= 0 || config.GroupPerMinute <= 0 {
+		return nil, fmt.Errorf("telegram rate limits must be positive, got %v per second and %v per minute to a group", config.GlobalPerSecond, config.GroupPerMinute)
+	}
+	now := time.Now()
+	return &RateLimiter{
+		config:    config,
+		global:    newTokenBucket(config.GlobalPerSecond, max(1, int(config.GlobalPerSecond)), now),
+		groups:    make(map[int64]*tokenBucket),
+		lastSweep: now,
+	}, nil
+}
+
+// Wait blocks until messages may be sent to chatID.
+func (l *RateLimiter) Wait(chatID int64, messages int) {
+	l.mu.Lock()
+	now := time.Now()
+	wait := max(0, l.pausedUntil.Sub(now))
+	if now.Sub(l.lastSweep) >= groupSweepInterval {
+		for id, group := range l.groups {
+			if group.idle(now) {
+				delete(l.groups, id)
+			}
+		}
+		l.lastSweep = now
+	}
+	// only group chats, which have negative ids, have a per chat limit
+	if chatID < 0 {
+		group, ok := l.groups[chatID]
+		if !ok {
+			group = newTokenBucket(l.config.GroupPerMinute/60, 1, now)
+			l.groups[chatID] = group
+		}
+		wait = max(wait, group.reserve(now, messages))
+	}
+	wait = max(wait, l.global.reserve(now, messages))
+	l.mu.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// Pause stops every message for d.
+func (l *RateLimiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// RateLimitedSender waits for the RateLimiter before every message, and pauses
+// it for every message when telegram responds with a retry_after.
+type RateLimitedSender struct {
+	sender  Sender
+	limiter *RateLimiter
+}
+
+func NewRateLimitedSender(sender Sender, limiter *RateLimiter) *RateLimitedSender {
+	return &RateLimitedSender{
+		sender:  sender,
+		limiter: limiter,
+	}
+}
+
+func (s *RateLimitedSender) wait(c tgbotapi.Chattable) {
+	chatID, _ := ChatIDOf(c)
+	messages := 1
+	if mediaGroup, ok := c.(tgbotapi.MediaGroupConfig); ok {
+		// telegram counts every photo of a media group as a message
+		messages = max(1, len(mediaGroup.Media))
+	}
+	s.limiter.Wait(chatID, messages)
+}
+
+func (s *RateLimitedSender) handleError(err error) {
+	if retryAfter := TelegramRetryAfter(err); retryAfter > 0 {
+		log.Warnf("telegram flood control, pausing all messages for %v", retryAfter)
+		s.limiter.Pause(retryAfter)
+	}
+}
+
+func (s *RateLimitedSender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	s.wait(c)
+	message, err := s.sender.Send(c)
+	s.handleError(err)
+	return message, err
+}
+
+func (s *RateLimitedSender) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	s.wait(c)
+	resp, err := s.sender.Request(c)
+	s.handleError(err)
+	return resp, err
+}
+
+// Broadcaster runs a job for many chats on a fixed number of workers.
+type Broadcaster struct {
+	Workers int
+}
+
+func NewBroadcaster(workers int) *Broadcaster {
+	return &Broadcaster{Workers: max(1, workers)}
+}
+
+// Broadcast calls fn once for every chat id, and returns once all calls are
+// done. Once ctx is done the remaining chats are skipped, while calls already
+// started run to completion.
+func (b *Broadcaster) Broadcast(ctx context.Context, chatIds []int64, fn func(chatId int64)) {
+	jobs := make(chan int64)
+	var wg sync.WaitGroup
+	for range min(b.Workers, len(chatIds)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chatId := range jobs {
+				fn(chatId)
+			}
+		}()
+	}
+dispatch:
+	for _, chatId := range chatIds {
+		select {
+		case <-ctx.Done():
+			log.Warnf("broadcast interrupted, skipping the remaining chats")
+			break dispatch
+		case jobs <- chatId:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
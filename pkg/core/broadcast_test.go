@@ -0,0 +1,71 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestNewRateLimiterRejectsNonPositiveRates(t *testing.T) {
+	for _, config := range []RateLimiterConfig{
+		{GlobalPerSecond: 0, GroupPerMinute: 20},
+		{GlobalPerSecond: 30, GroupPerMinute: 0},
+		{GlobalPerSecond: -1, GroupPerMinute: 20},
+	} {
+		if _, err := NewRateLimiter(config); err == nil {
+			t.Errorf("expected an error for %+v", config)
+		}
+	}
+}
+
+func TestRateLimiterEvictsIdleGroups(t *testing.T) {
+	limiter, err := NewRateLimiter(RateLimiterConfig{GlobalPerSecond: 1000, GroupPerMinute: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for chatID := int64(-1); chatID >= -100; chatID-- {
+		limiter.Wait(chatID, 1)
+	}
+	if len(limiter.groups) != 100 {
+		t.Fatalf("tracking %v groups, want 100", len(limiter.groups))
+	}
+
+	// every group but the last has refilled since its message
+	limiter.mu.Lock()
+	for chatID, group := range limiter.groups {
+		if chatID != -100 {
+			group.last = group.last.Add(-time.Minute)
+		}
+	}
+	limiter.lastSweep = limiter.lastSweep.Add(-groupSweepInterval)
+	limiter.mu.Unlock()
+
+	limiter.Wait(1, 1)
+	if len(limiter.groups) != 1 {
+		t.Errorf("tracking %v groups after the sweep, want the 1 still limited", len(limiter.groups))
+	}
+}
+
+func TestRateLimitedSenderCountsEveryPhotoOfMediaGroup(t *testing.T) {
+	// fast enough for the wait on the second photo to be short
+	limiter, err := NewRateLimiter(RateLimiterConfig{GlobalPerSecond: 30, GroupPerMinute: 6000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := NewRateLimitedSender(nil, limiter)
+	sender.wait(tgbotapi.NewMediaGroup(-1, []any{
+		tgbotapi.NewInputMediaPhoto(tgbotapi.FileID("chart")),
+		tgbotapi.NewInputMediaPhoto(tgbotapi.FileID("curve")),
+	}))
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	// a burst of one, less the two photos
+	if tokens := limiter.groups[-1].tokens; tokens > -0.99 {
+		t.Errorf("group has %v tokens left, want -1", tokens)
+	}
+	if tokens := limiter.global.tokens; tokens > 28.01 {
+		t.Errorf("%v global tokens left, want 28", tokens)
+	}
+}
@@ -0,0 +1,208 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+	log "github.com/sirupsen/logrus"
+)
+
+// couponPaymentsPerYear is how often savings bonds pay interest.
+const couponPaymentsPerYear = 2
+
+// CouponPayment is one interest payment of a holding.
+type CouponPayment struct {
+	IssueCode string
+	Date      time.Time
+	Year      int     // year of the bond the payment is for, from 1 to 10
+	Coupon    float64 // coupon rate of the year, in percent
+	Amount    float64 // in dollars
+}
+
+// CouponSchedule expands a holding of principal dollars of bond into its
+// payments to maturity. Interest is paid every six months from the first
+// interest date, each payment half of the year's coupon.
+func CouponSchedule(bond schemas.SavingsBonds, interest schemas.BondInterest, principal int) []CouponPayment {
+	firstInterestDate := time.Time(bond.FirstInterestDate)
+	if firstInterestDate.IsZero() {
+		firstInterestDate = time.Time(bond.IssueDate).AddDate(0, 6, 0)
+	}
+	yearCoupons := interest.Coupons()
+	payments := make([]CouponPayment, 0, len(yearCoupons)*couponPaymentsPerYear)
+	for i := range len(yearCoupons) * couponPaymentsPerYear {
+		year := i/couponPaymentsPerYear + 1
+		coupon := yearCoupons[year-1]
+		payments = append(payments, CouponPayment{
+			IssueCode: bond.IssueCode,
+			Date:      firstInterestDate.AddDate(0, 12/couponPaymentsPerYear*i, 0),
+			Year:      year,
+			Coupon:    coupon,
+			Amount:    float64(principal) * coupon / 100 / couponPaymentsPerYear,
+		})
+	}
+	return payments
+}
+
+// CouponCalendar returns the payments of every holding between from and to,
+// inclusive of both dates, ordered by date. Holdings of issues missing from
+// bonds or bondInterests are left out.
+func CouponCalendar(holdings []schemas.Holding, bonds map[string]schemas.SavingsBonds, bondInterests map[string]schemas.BondInterest, from time.Time, to time.Time) []CouponPayment {
+	fromDate, toDate := from.Format(time.DateOnly), to.Format(time.DateOnly)
+	var payments []CouponPayment
+	for _, holding := range holdings {
+		bond, ok := bonds[holding.IssueCode]
+		if !ok {
+			continue
+		}
+		interest, ok := bondInterests[holding.IssueCode]
+		if !ok {
+			continue
+		}
+		for _, payment := range CouponSchedule(bond, interest, holding.Amount) {
+			// compare calendar dates, payment dates from MAS have no timezone
+			date := payment.Date.Format(time.DateOnly)
+			if date >= fromDate && date <= toDate {
+				payments = append(payments, payment)
+			}
+		}
+	}
+	sort.SliceStable(payments, func(i, j int) bool {
+		if !payments[i].Date.Equal(payments[j].Date) {
+			return payments[i].Date.Before(payments[j].Date)
+		}
+		return payments[i].IssueCode < payments[j].IssueCode
+	})
+	return payments
+}
+
+// ListHeldBonds returns the bonds of the given issue codes keyed by issue code,
+// from all issues that could still be held. Issue codes not found are left
+// out of the map.
+func ListHeldBonds(ctx context.Context, masClient MASClient, localTimezone *time.Location, issueCodes []string) (map[string]schemas.SavingsBonds, error) {
+	now := time.Now().In(localTimezone)
+	// bonds mature 10 years after they are issued, and are listed about a
+	// month before
+	bondsPtr, err := masClient.ListBonds(ctx, now.AddDate(-11, 0, 0), now.AddDate(0, 2, 0), 12*12)
+	if err != nil {
+		return nil, err
+	}
+	wanted := make(map[string]bool, len(issueCodes))
+	for _, issueCode := range issueCodes {
+		wanted[issueCode] = true
+	}
+	bonds := make(map[string]schemas.SavingsBonds, len(issueCodes))
+	for _, bond := range *bondsPtr {
+		if wanted[bond.IssueCode] {
+			bonds[bond.IssueCode] = bond
+		}
+	}
+	return bonds, nil
+}
+
+// HoldingsCalendar returns the coupon payments of holdings between from and to.
+func HoldingsCalendar(ctx context.Context, masClient MASClient, localTimezone *time.Location, holdings []schemas.Holding, from time.Time, to time.Time) ([]CouponPayment, error) {
+	issueCodes := make([]string, len(holdings))
+	for i, holding := range holdings {
+		issueCodes[i] = holding.IssueCode
+	}
+	bonds, err := ListHeldBonds(ctx, masClient, localTimezone, issueCodes)
+	if err != nil {
+		return nil, err
+	}
+	bondInterests, err := masClient.ListBondInterests(ctx, issueCodes)
+	if err != nil {
+		return nil, err
+	}
+	return CouponCalendar(holdings, bonds, bondInterests, from, to), nil
+}
+
+// FormatCalendar returns the MarkdownV2 listing of payments grouped by month.
+func FormatCalendar(payments []CouponPayment) string {
+	var b strings.Builder
+	b.WriteString("📅 *Coupon Payments in the Next 12 Months* 📅\n")
+	if len(payments) == 0 {
+		b.WriteString("\nNone of your holdings pay interest in the next 12 months.\n")
+		return strings.Replace(b.String(), ".", "\\.", -1)
+	}
+	month := ""
+	total := 0.0
+	for _, payment := range payments {
+		if m := payment.Date.Format("Jan 2006"); m != month {
+			month = m
+			fmt.Fprintf(&b, "\n*%s*\n", month)
+		}
+		total += payment.Amount
+		fmt.Fprintf(&b, "\\- %s: %s from %s \\(year %v, %.2f%%\\)\n", payment.Date.Format("02 Jan"), FormatDollars(payment.Amount), payment.IssueCode, payment.Year, payment.Coupon)
+	}
+	fmt.Fprintf(&b, "\n*Total:* %s\n", FormatDollars(total))
+	return strings.Replace(b.String(), ".", "\\.", -1)
+}
+
+// FormatPayoutNotification returns the MarkdownV2 notification of the coupon
+// payments made today.
+func FormatPayoutNotification(payments []CouponPayment) string {
+	var b strings.Builder
+	b.WriteString("💰 *Coupon Payments Today* 💰\n\n")
+	total := 0.0
+	for _, payment := range payments {
+		total += payment.Amount
+		fmt.Fprintf(&b, "\\- %s from %s \\(year %v, %.2f%%\\)\n", FormatDollars(payment.Amount), payment.IssueCode, payment.Year, payment.Coupon)
+	}
+	if len(payments) > 1 {
+		fmt.Fprintf(&b, "\n*Total:* %s\n", FormatDollars(total))
+	}
+	return strings.Replace(b.String(), ".", "\\.", -1)
+}
+
+// NotifyPayouts notifies every chat with PayoutNotifications set of the
+// coupon payments its holdings make today, once a day. Chats without payments
+// today are marked as checked so later runs skip them.
+func (s *Scheduler) NotifyPayouts(ctx context.Context) error {
+	today := time.Now().In(s.Timezone)
+	date := today.Format(time.DateOnly)
+	var chats []schemas.ChatSettings
+	err := Retry(ctx, DefaultRetryPolicy, "get users to notify of payouts", func() (err error) {
+		chats, err = s.Repository.GetUsersToNotifyPayouts(ctx, date)
+		return err
+	})
+	if err != nil || len(chats) == 0 {
+		return err
+	}
+	chatIds := make([]int64, len(chats))
+	for i, chat := range chats {
+		chatIds[i] = chat.ChatId
+	}
+
+	s.Broadcaster.Broadcast(ctx, chatIds, func(chatId int64) {
+		if err := s.notifyChatPayouts(ctx, chatId, today); err != nil {
+			log.Errorf("error notifying chat %v of payouts (%v): %v", chatId, ClassifyTelegramError(err), err)
+		}
+	})
+	return nil
+}
+
+func (s *Scheduler) notifyChatPayouts(ctx context.Context, chatId int64, today time.Time) error {
+	var payments []CouponPayment
+	err := Retry(ctx, DefaultRetryPolicy, fmt.Sprintf("get payouts of chat %v", chatId), func() error {
+		holdings, err := s.Repository.GetHoldings(ctx, chatId)
+		if err != nil || len(holdings) == 0 {
+			return err
+		}
+		payments, err = HoldingsCalendar(ctx, s.MASClient, s.Timezone, holdings, today, today)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	markChecked := func(chatSettings *schemas.ChatSettings) {
+		chatSettings.LastPayoutNotified = today.Format(time.DateOnly)
+	}
+	if len(payments) == 0 {
+		return s.updateChatSettings(ctx, chatId, markChecked)
+	}
+	return s.sendMessageToChat(ctx, chatId, FormatPayoutNotification(payments), markChecked)
+}
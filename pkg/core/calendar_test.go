@@ -0,0 +1,62 @@
+package core_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/core"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+)
+
+func TestCouponSchedule(t *testing.T) {
+	bond, interest := testBond("SBMAR23", date(2023, 3, 1))
+	payments := core.CouponSchedule(bond, interest, 10000)
+	if len(payments) != 20 {
+		t.Fatalf("got %v payments, want 20", len(payments))
+	}
+	for i, want := range []struct {
+		date   time.Time
+		year   int
+		amount float64
+	}{
+		{date(2023, 9, 1), 1, 100},
+		{date(2024, 3, 1), 1, 100},
+		{date(2024, 9, 1), 2, 105},
+	} {
+		payment := payments[i]
+		if !payment.Date.Equal(want.date) || payment.Year != want.year || payment.Amount != want.amount {
+			t.Errorf("payment %v is %v in year %v on %v, want %v in year %v on %v", i, payment.Amount, payment.Year, payment.Date.Format(time.DateOnly), want.amount, want.year, want.date.Format(time.DateOnly))
+		}
+	}
+	if last := payments[len(payments)-1]; !last.Date.Equal(date(2033, 3, 1)) || last.Year != 10 {
+		t.Errorf("last payment is in year %v on %v, want year 10 on the maturity date", last.Year, last.Date.Format(time.DateOnly))
+	}
+}
+
+func TestCouponCalendar(t *testing.T) {
+	march, marchInterest := testBond("SBMAR23", date(2023, 3, 1))
+	june, juneInterest := testBond("SBJUN23", date(2023, 6, 1))
+	bonds := map[string]schemas.SavingsBonds{march.IssueCode: march, june.IssueCode: june}
+	bondInterests := map[string]schemas.BondInterest{march.IssueCode: marchInterest, june.IssueCode: juneInterest}
+	holdings := []schemas.Holding{
+		{IssueCode: "SBJUN23", Amount: 5000},
+		{IssueCode: "SBMAR23", Amount: 10000},
+		{IssueCode: "SBXXX", Amount: 500}, // unknown issues are left out
+	}
+
+	payments := core.CouponCalendar(holdings, bonds, bondInterests, date(2024, 3, 1), date(2024, 12, 1))
+	var got []string
+	for _, payment := range payments {
+		got = append(got, payment.IssueCode+" "+payment.Date.Format(time.DateOnly))
+	}
+	want := []string{"SBMAR23 2024-03-01", "SBJUN23 2024-06-01", "SBMAR23 2024-09-01", "SBJUN23 2024-12-01"}
+	if len(got) != len(want) {
+		t.Fatalf("got payments %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got payments %v, want %v", got, want)
+			break
+		}
+	}
+}
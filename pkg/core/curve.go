@@ -0,0 +1,137 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/metrics"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vicanso/go-charts/v2"
+)
+
+// GenerateCouponCurveChart plots the coupon and the average return of each
+// year of a bond, overlaying those of previous if it is not nil.
+func GenerateCouponCurveChart(interest schemas.BondInterest, previous *schemas.BondInterest) (*[]byte, error) {
+	timer := prometheus.NewTimer(metrics.ChartRenderDuration)
+	defer timer.ObserveDuration()
+	years := make([]string, schemas.BondTenorYears)
+	for i := range years {
+		years[i] = fmt.Sprintf("Year %v", i+1)
+	}
+
+	seriesList := []charts.Series{
+		{
+			Type:  charts.ChartTypeLine,
+			Name:  interest.IssueCode + " Coupon",
+			Data:  charts.NewSeriesDataFromValues(interest.Coupons()),
+			Label: charts.SeriesLabel{Show: *charts.TrueFlag()},
+		},
+		{
+			Type: charts.ChartTypeLine,
+			Name: interest.IssueCode + " Average Return",
+			Data: charts.NewSeriesDataFromValues(interest.Returns()),
+		},
+	}
+	title := fmt.Sprintf("%v Step-up Coupons", interest.IssueCode)
+	if previous != nil {
+		seriesList = append(seriesList,
+			charts.Series{
+				Type: charts.ChartTypeLine,
+				Name: previous.IssueCode + " Coupon",
+				Data: charts.NewSeriesDataFromValues(previous.Coupons()),
+			},
+			charts.Series{
+				Type: charts.ChartTypeLine,
+				Name: previous.IssueCode + " Average Return",
+				Data: charts.NewSeriesDataFromValues(previous.Returns()),
+			},
+		)
+		title = fmt.Sprintf("%v Step-up Coupons against %v", interest.IssueCode, previous.IssueCode)
+	}
+	legendData := make([]string, len(seriesList))
+	for i, series := range seriesList {
+		legendData[i] = series.Name
+	}
+	legend := charts.NewLegendOption(legendData, charts.PositionRight)
+	// below the title, which the four series names do not fit beside
+	legend.Top = "25"
+
+	chartOption := charts.ChartOption{
+		Width:      1000,
+		Height:     400,
+		SeriesList: seriesList,
+		Title: charts.TitleOption{
+			Text: title,
+		},
+		Padding: charts.Box{
+			Top:    20,
+			Left:   20,
+			Right:  20,
+			Bottom: 20,
+		},
+		Legend: legend,
+		XAxis:  charts.NewXAxisOption(years),
+		ValueFormatter: func(f float64) string {
+			return fmt.Sprintf("%.2f", f) + "%"
+		},
+	}
+	p, err := charts.Render(chartOption)
+	if err != nil {
+		return nil, err
+	}
+
+	buf, err := p.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// PreviousIssue returns the bond issued the month before bond, or nil if
+// there is none.
+func PreviousIssue(ctx context.Context, masClient MASClient, bond schemas.SavingsBonds) (*schemas.SavingsBonds, error) {
+	issueDate := time.Time(bond.IssueDate)
+	bondsPtr, err := masClient.ListBonds(ctx, issueDate.AddDate(0, -1, 0), issueDate.AddDate(0, 0, -1), 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(*bondsPtr) == 0 {
+		return nil, nil
+	}
+	previous := (*bondsPtr)[0]
+	return &previous, nil
+}
+
+// RenderCouponCurve charts the coupon curve of bond against the issue before
+// it.
+func RenderCouponCurve(ctx context.Context, masClient MASClient, bond schemas.SavingsBonds) ([]byte, error) {
+	previousBond, err := PreviousIssue(ctx, masClient, bond)
+	if err != nil {
+		return nil, err
+	}
+	issueCodes := []string{bond.IssueCode}
+	if previousBond != nil {
+		issueCodes = append(issueCodes, previousBond.IssueCode)
+	}
+	bondInterests, err := masClient.ListBondInterests(ctx, issueCodes)
+	if err != nil {
+		return nil, err
+	}
+	interest, ok := bondInterests[bond.IssueCode]
+	if !ok {
+		return nil, fmt.Errorf("savings bonds with issue code: %v not found", bond.IssueCode)
+	}
+	var previous *schemas.BondInterest
+	if previousBond != nil {
+		if previousInterest, ok := bondInterests[previousBond.IssueCode]; ok {
+			previous = &previousInterest
+		}
+	}
+	buf, err := GenerateCouponCurveChart(interest, previous)
+	if err != nil {
+		return nil, err
+	}
+	return *buf, nil
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+)
+
+// MaxHoldingAmount is the most an individual may hold across all savings
+// bonds, in dollars.
+const MaxHoldingAmount = 200_000
+
+// HoldingAmountMultiple is the unit savings bonds are applied for in.
+const HoldingAmountMultiple = 500
+
+// ProjectedInterest returns the interest an amount held to maturity is paid
+// over the 10 years of the bond.
+func ProjectedInterest(amount int, interest schemas.BondInterest) float64 {
+	total := 0.0
+	for _, coupon := range interest.Coupons() {
+		total += float64(amount) * coupon / 100
+	}
+	return total
+}
+
+// TotalHoldings returns the sum of the amounts held.
+func TotalHoldings(holdings []schemas.Holding) int {
+	total := 0
+	for _, holding := range holdings {
+		total += holding.Amount
+	}
+	return total
+}
+
+// ValidateHoldingAmount checks that holding amount of issueCode instead of the
+// current holding of it is in units of HoldingAmountMultiple and keeps the
+// total holdings within MaxHoldingAmount.
+func ValidateHoldingAmount(holdings []schemas.Holding, issueCode string, amount int) error {
+	if amount <= 0 || amount%HoldingAmountMultiple != 0 {
+		return fmt.Errorf("amount must be a multiple of %v", FormatDollars(HoldingAmountMultiple))
+	}
+	total := amount
+	for _, holding := range holdings {
+		if holding.IssueCode != issueCode {
+			total += holding.Amount
+		}
+	}
+	if total > MaxHoldingAmount {
+		return fmt.Errorf("total holdings of %v would exceed the %v limit", FormatDollars(float64(total)), FormatDollars(MaxHoldingAmount))
+	}
+	return nil
+}
+
+// FormatHoldings returns the MarkdownV2 summary of a chat's holdings with the
+// interest each is projected to pay to maturity. Holdings of issues missing
+// from bondInterests are listed without interest.
+func FormatHoldings(holdings []schemas.Holding, bondInterests map[string]schemas.BondInterest) string {
+	var b strings.Builder
+	b.WriteString("💼 *Your Savings Bonds* 💼\n\n")
+	totalInterest := 0.0
+	for _, holding := range holdings {
+		fmt.Fprintf(&b, "*%s:* %s", holding.IssueCode, FormatDollars(float64(holding.Amount)))
+		interest, ok := bondInterests[holding.IssueCode]
+		if !ok {
+			b.WriteString(", interest rates not found\n")
+			continue
+		}
+		projected := ProjectedInterest(holding.Amount, interest)
+		totalInterest += projected
+		fmt.Fprintf(&b, ", %.2f%% a year, %s interest to maturity\n", interest.ReturnAt(schemas.BondTenorYears), FormatDollars(projected))
+	}
+	total := TotalHoldings(holdings)
+	fmt.Fprintf(&b, "\n*Total:* %s, %s interest to maturity\n", FormatDollars(float64(total)), FormatDollars(totalInterest))
+	fmt.Fprintf(&b, "*Remaining Limit:* %s of %s\n", FormatDollars(float64(MaxHoldingAmount-total)), FormatDollars(MaxHoldingAmount))
+	return strings.Replace(b.String(), ".", "\\.", -1)
+}
@@ -0,0 +1,42 @@
+package core_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/core"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+)
+
+func TestValidateHoldingAmount(t *testing.T) {
+	holdings := []schemas.Holding{
+		{IssueCode: "SBJAN25", Amount: 150_000},
+		{IssueCode: "SBFEB25", Amount: 10_000},
+	}
+	for _, tc := range []struct {
+		issueCode string
+		amount    int
+		wantErr   bool
+	}{
+		{"SBMAR25", 40_000, false},
+		{"SBMAR25", 40_500, true},
+		{"SBJAN25", 190_000, false}, // replaces the current holding of SBJAN25
+		{"SBJAN25", 190_500, true},
+		{"SBMAR25", 750, true},
+		{"SBMAR25", 0, true},
+		{"SBMAR25", -500, true},
+	} {
+		err := core.ValidateHoldingAmount(holdings, tc.issueCode, tc.amount)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("holding %v of %v: got error %v, want error %v", tc.amount, tc.issueCode, err, tc.wantErr)
+		}
+	}
+}
+
+func TestProjectedInterest(t *testing.T) {
+	_, interest := testBond("SBMAR23", date(2023, 3, 1))
+	// coupons of 2% stepping up to 2.9% add up to 24.5%
+	if got := core.ProjectedInterest(10000, interest); math.Abs(got-2450) > 1e-9 {
+		t.Errorf("projected interest is %v, want 2450", got)
+	}
+}
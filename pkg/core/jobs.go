@@ -0,0 +1,121 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// JobSchedules are the cron expressions of the scheduled jobs, in the standard
+// five field format or a descriptor such as "@hourly", evaluated in the
+// scheduler's timezone. An empty schedule disables the job.
+type JobSchedules struct {
+	// checks MAS for a newly announced issue and notifies subscribers
+	Announcement string `json:"announcement"`
+	// prunes old outbox entries
+	Maintenance string `json:"maintenance"`
+	// reminds chats that the latest issue's applications close soon
+	Reminders string `json:"reminders"`
+	// sends the allotment results of the latest tendered issue
+	Allotment string `json:"allotment"`
+	// notifies chats of the coupon payments their holdings make that day
+	Payouts string `json:"payouts"`
+}
+
+var DefaultJobSchedules = JobSchedules{
+	Announcement: "*/10 * * * *",
+	Maintenance:  "0 3 * * *",
+	Reminders:    "0 9 * * *",
+	Allotment:    "0 * * * *",
+	Payouts:      "0 8 * * *",
+}
+
+// LoadJobSchedules reads a json file of job schedules, e.g.
+// {"announcement": "0 9-18 1-7 * 1-5"}. Jobs left out of the file keep the
+// schedule in defaults.
+func LoadJobSchedules(path string, defaults JobSchedules) (JobSchedules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return defaults, err
+	}
+	schedules := defaults
+	if err := json.Unmarshal(data, &schedules); err != nil {
+		return defaults, fmt.Errorf("error parsing job schedules in %v: %w", path, err)
+	}
+	return schedules, nil
+}
+
+// outboxRetention is how long notification outbox entries are kept.
+const outboxRetention = 6 * 30 * 24 * time.Hour
+
+// Maintenance prunes outbox entries of issues long past.
+func (s *Scheduler) Maintenance(ctx context.Context) error {
+	before := time.Now().In(s.Timezone).Add(-outboxRetention)
+	return s.Repository.PruneNotifications(ctx, before)
+}
+
+func (s *Scheduler) jobs() []struct {
+	name     string
+	schedule string
+	run      func(ctx context.Context) error
+} {
+	return []struct {
+		name     string
+		schedule string
+		run      func(ctx context.Context) error
+	}{
+		{"announcement", s.Schedules.Announcement, s.NotifySubscribers},
+		{"maintenance", s.Schedules.Maintenance, s.Maintenance},
+		{"reminders", s.Schedules.Reminders, s.SendReminders},
+		{"allotment", s.Schedules.Allotment, s.NotifyAllotment},
+		{"payouts", s.Schedules.Payouts, s.NotifyPayouts},
+	}
+}
+
+// Run starts every scheduled job and blocks until ctx is done. A job that is
+// still running when it is next due is skipped. Once ctx is done no new job is
+// started, and running jobs are given shutdownTimeout to finish before their
+// context is cancelled too.
+func (s *Scheduler) Run(ctx context.Context, shutdownTimeout time.Duration) error {
+	// jobs outlive ctx until the shutdown timeout, so in flight writes can finish
+	jobCtx, cancelJobs := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelJobs()
+
+	c := cron.New(
+		cron.WithLocation(s.Timezone),
+		cron.WithChain(cron.Recover(cron.DefaultLogger), cron.SkipIfStillRunning(cron.DefaultLogger)),
+	)
+	for _, job := range s.jobs() {
+		if job.schedule == "" {
+			log.Infof("%v job disabled", job.name)
+			continue
+		}
+		if _, err := c.AddFunc(job.schedule, func() {
+			log.Debugf("running %v job", job.name)
+			if err := job.run(jobCtx); err != nil {
+				log.Errorf("error running %v job: %v", job.name, err)
+			}
+		}); err != nil {
+			return fmt.Errorf("invalid schedule %q for %v job: %w", job.schedule, job.name, err)
+		}
+		log.Infof("scheduled %v job at %q", job.name, job.schedule)
+	}
+	c.Start()
+
+	<-ctx.Done()
+	log.Info("stopping scheduler")
+	stopped := c.Stop()
+	select {
+	case <-stopped.Done():
+	case <-time.After(shutdownTimeout):
+		log.Warnf("scheduled jobs still running after %v, cancelling them", shutdownTimeout)
+		cancelJobs()
+		<-stopped.Done()
+	}
+	return nil
+}
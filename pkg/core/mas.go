@@ -0,0 +1,172 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/metrics"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// MASClient retrieves savings bonds data from the MAS statistics API, or any
+// other source that can serve the same records.
+type MASClient interface {
+	ListBonds(ctx context.Context, startDate time.Time, endDate time.Time, rows int) (*[]schemas.SavingsBonds, error)
+	GetBondInterest(ctx context.Context, issueCode string) (*schemas.BondInterest, error)
+	// ListBondInterests fetches the interest records of every issue code in a
+	// single request, keyed by issue code. Missing issue codes are left out of
+	// the map rather than returned as an error.
+	ListBondInterests(ctx context.Context, issueCodes []string) (map[string]schemas.BondInterest, error)
+}
+
+type MASClientConfig struct {
+	BaseURL   string            // defaults to utils.DEFAULT_MAS_BASE_URL
+	Timeout   time.Duration     // zero means no timeout
+	Transport http.RoundTripper // defaults to http.DefaultTransport
+	UserAgent string            // defaults to utils.DEFAULT_MAS_USER_AGENT
+}
+
+// masPingMaxAge is how long the outcome of the last request to the MAS api
+// answers Ping, so readiness probes do not query MAS on every call.
+const masPingMaxAge = time.Minute
+
+// HTTPMASClient is the MASClient backed by the MAS bondsandbills REST endpoints.
+type HTTPMASClient struct {
+	baseURL   string
+	userAgent string
+	client    *http.Client
+
+	mu          sync.Mutex
+	lastRequest time.Time
+	lastErr     error
+}
+
+func NewMASClient(config MASClientConfig) *HTTPMASClient {
+	baseURL := strings.TrimSuffix(config.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = utils.DEFAULT_MAS_BASE_URL
+	}
+	userAgent := config.UserAgent
+	if userAgent == "" {
+		userAgent = utils.DEFAULT_MAS_USER_AGENT
+	}
+	return &HTTPMASClient{
+		baseURL:   baseURL,
+		userAgent: userAgent,
+		client: &http.Client{
+			Timeout:   config.Timeout,
+			Transport: config.Transport,
+		},
+	}
+}
+
+func (c *HTTPMASClient) get(ctx context.Context, path string, queryParams string, v any) error {
+	start := time.Now()
+	err := c.request(ctx, path, queryParams, v)
+	metrics.MASRequestDuration.WithLabelValues(path, metrics.Outcome(err)).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// request queries the MAS api and records the outcome for Ping.
+func (c *HTTPMASClient) request(ctx context.Context, path string, queryParams string, v any) (err error) {
+	defer func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.lastRequest, c.lastErr = time.Now(), err
+	}()
+	endpoint := fmt.Sprintf("%v/%v?%v", c.baseURL, path, queryParams)
+
+	log.Debugf("querying %v", endpoint)
+
+	req, httpErr := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if httpErr != nil {
+		return httpErr
+	}
+	req.Header.Set("User-Agent", c.userAgent) // need to set user-agent if not will throw 403 error
+	res, httpErr := c.client.Do(req)
+	if httpErr != nil {
+		return httpErr
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode != 200 {
+		return fmt.Errorf("status code %v error querying %v from mas api: %v", res.StatusCode, path, string(body))
+	}
+	return json.Unmarshal(body, v)
+}
+
+// Ping checks that the MAS api can be reached. It returns the outcome of the
+// last request made within masPingMaxAge, and otherwise lists a single bond,
+// which is left out of the request metrics.
+func (c *HTTPMASClient) Ping(ctx context.Context) error {
+	c.mu.Lock()
+	lastRequest, lastErr := c.lastRequest, c.lastErr
+	c.mu.Unlock()
+	if time.Since(lastRequest) < masPingMaxAge {
+		return lastErr
+	}
+	var savingsBondsAPIResponse schemas.ListSavingsBondsResponse
+	return c.request(ctx, "listsavingbonds", "rows=1", &savingsBondsAPIResponse)
+}
+
+func (c *HTTPMASClient) ListBonds(ctx context.Context, startDate time.Time, endDate time.Time, rows int) (*[]schemas.SavingsBonds, error) {
+	queryParams := fmt.Sprintf("rows=%v&filters=issue_date:[%v+TO+%v]&sort=issue_date+desc", rows, startDate.Format(time.DateOnly), endDate.Format(time.DateOnly))
+	var savingsBondsAPIResponse schemas.ListSavingsBondsResponse
+	if err := c.get(ctx, "listsavingbonds", queryParams, &savingsBondsAPIResponse); err != nil {
+		return nil, err
+	}
+
+	return &savingsBondsAPIResponse.Result.Records, nil
+}
+
+func (c *HTTPMASClient) GetBondInterest(ctx context.Context, issueCode string) (*schemas.BondInterest, error) {
+	queryParams := fmt.Sprintf("filters=issue_code:%v", url.QueryEscape(issueCode))
+	var savingsBondsInterestsAPIResponse schemas.ListSavingsBondsInterestResponse
+	if err := c.get(ctx, "savingbondsinterest", queryParams, &savingsBondsInterestsAPIResponse); err != nil {
+		return nil, err
+	}
+
+	if len(savingsBondsInterestsAPIResponse.Result.Records) == 0 {
+		return nil, fmt.Errorf("savings bonds with issue code: %v not found", issueCode)
+	}
+	bondInterest := savingsBondsInterestsAPIResponse.Result.Records[0]
+	if err := bondInterest.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid interest record from mas: %w", err)
+	}
+	return &bondInterest, nil
+}
+
+func (c *HTTPMASClient) ListBondInterests(ctx context.Context, issueCodes []string) (map[string]schemas.BondInterest, error) {
+	bondInterests := make(map[string]schemas.BondInterest, len(issueCodes))
+	if len(issueCodes) == 0 {
+		return bondInterests, nil
+	}
+	escapedIssueCodes := make([]string, len(issueCodes))
+	for i, issueCode := range issueCodes {
+		escapedIssueCodes[i] = url.QueryEscape(issueCode)
+	}
+	queryParams := fmt.Sprintf("rows=%v&filters=issue_code:(%v)", len(issueCodes), strings.Join(escapedIssueCodes, "+OR+"))
+	var savingsBondsInterestsAPIResponse schemas.ListSavingsBondsInterestResponse
+	if err := c.get(ctx, "savingbondsinterest", queryParams, &savingsBondsInterestsAPIResponse); err != nil {
+		return nil, err
+	}
+
+	for _, record := range savingsBondsInterestsAPIResponse.Result.Records {
+		if err := record.Validate(); err != nil {
+			// callers treat the issue as missing rather than failing every issue
+			log.Errorf("skipping invalid interest record from mas: %v", err)
+			continue
+		}
+		bondInterests[record.IssueCode] = record
+	}
+	return bondInterests, nil
+}
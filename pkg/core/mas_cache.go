@@ -0,0 +1,201 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+	log "github.com/sirupsen/logrus"
+)
+
+type CachedMASClientConfig struct {
+	ListBondsTTL    time.Duration // how long a bond listing stays fresh
+	BondInterestTTL time.Duration // how long an issue's interest record stays fresh
+	Timezone        *time.Location
+}
+
+type masCacheEntry[T any] struct {
+	value     T
+	expiresAt time.Time
+}
+
+// CachedMASClient is a MASClient that shares bond listings and interest records
+// between callers. Every entry also expires at the start of the next month in
+// the configured timezone, since that is when MAS announces the next SSB issue.
+type CachedMASClient struct {
+	client MASClient
+	config CachedMASClientConfig
+	now    func() time.Time
+
+	mu            sync.Mutex
+	month         time.Time
+	bonds         map[string]masCacheEntry[[]schemas.SavingsBonds]
+	bondInterests map[string]masCacheEntry[schemas.BondInterest]
+	inflight      map[string]*sync.WaitGroup
+}
+
+func NewCachedMASClient(client MASClient, config CachedMASClientConfig) *CachedMASClient {
+	if config.Timezone == nil {
+		config.Timezone = time.UTC
+	}
+	c := &CachedMASClient{
+		client:   client,
+		config:   config,
+		now:      time.Now,
+		inflight: make(map[string]*sync.WaitGroup),
+	}
+	c.Invalidate()
+	return c
+}
+
+// Invalidate drops every cached entry.
+func (c *CachedMASClient) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reset(c.now())
+}
+
+// reset must be called with c.mu held.
+func (c *CachedMASClient) reset(now time.Time) {
+	c.month = startOfMonth(now.In(c.config.Timezone))
+	c.bonds = make(map[string]masCacheEntry[[]schemas.SavingsBonds])
+	c.bondInterests = make(map[string]masCacheEntry[schemas.BondInterest])
+}
+
+// expiry returns when an entry cached now with the given ttl goes stale, and
+// flushes the whole cache if a new month has started. Must be called with c.mu held.
+func (c *CachedMASClient) expiry(now time.Time, ttl time.Duration) time.Time {
+	if month := startOfMonth(now.In(c.config.Timezone)); !month.Equal(c.month) {
+		log.Debugf("new month %v started, invalidating mas cache", month.Format("Jan 2006"))
+		c.reset(now)
+	}
+	expiresAt := now.Add(ttl)
+	if nextMonth := c.month.AddDate(0, 1, 0); nextMonth.Before(expiresAt) {
+		expiresAt = nextMonth
+	}
+	return expiresAt
+}
+
+// singleflight makes concurrent callers with the same key wait for the first
+// caller's fetch instead of all querying MAS. It reports whether the caller
+// should do the fetch itself, in which case it must call the returned func when done.
+func (c *CachedMASClient) singleflight(key string) (bool, func()) {
+	c.mu.Lock()
+	if wg, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		wg.Wait()
+		return false, nil
+	}
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	c.inflight[key] = wg
+	c.mu.Unlock()
+	return true, func() {
+		c.mu.Lock()
+		delete(c.inflight, key)
+		c.mu.Unlock()
+		wg.Done()
+	}
+}
+
+func (c *CachedMASClient) ListBonds(ctx context.Context, startDate time.Time, endDate time.Time, rows int) (*[]schemas.SavingsBonds, error) {
+	key := fmt.Sprintf("%v|%v|%v", startDate.Format(time.DateOnly), endDate.Format(time.DateOnly), rows)
+	for {
+		c.mu.Lock()
+		now := c.now()
+		c.expiry(now, 0)
+		entry, ok := c.bonds[key]
+		c.mu.Unlock()
+		if ok && now.Before(entry.expiresAt) {
+			bonds := append([]schemas.SavingsBonds(nil), entry.value...)
+			return &bonds, nil
+		}
+
+		fetch, done := c.singleflight("bonds|" + key)
+		if !fetch {
+			continue
+		}
+		bondsPtr, err := c.client.ListBonds(ctx, startDate, endDate, rows)
+		if err == nil {
+			c.mu.Lock()
+			now := c.now()
+			c.bonds[key] = masCacheEntry[[]schemas.SavingsBonds]{
+				value:     append([]schemas.SavingsBonds(nil), (*bondsPtr)...),
+				expiresAt: c.expiry(now, c.config.ListBondsTTL),
+			}
+			c.mu.Unlock()
+		}
+		done()
+		return bondsPtr, err
+	}
+}
+
+func (c *CachedMASClient) GetBondInterest(ctx context.Context, issueCode string) (*schemas.BondInterest, error) {
+	bondInterests, err := c.ListBondInterests(ctx, []string{issueCode})
+	if err != nil {
+		return nil, err
+	}
+	bondInterest, ok := bondInterests[issueCode]
+	if !ok {
+		return nil, fmt.Errorf("savings bonds with issue code: %v not found", issueCode)
+	}
+	return &bondInterest, nil
+}
+
+// cachedBondInterests copies the fresh cached records into bondInterests and
+// returns the issue codes that still need to be fetched.
+func (c *CachedMASClient) cachedBondInterests(issueCodes []string, bondInterests map[string]schemas.BondInterest) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	c.expiry(now, 0)
+	var missing []string
+	for _, issueCode := range issueCodes {
+		if entry, ok := c.bondInterests[issueCode]; ok && now.Before(entry.expiresAt) {
+			bondInterests[issueCode] = entry.value
+		} else if _, fetched := bondInterests[issueCode]; !fetched {
+			missing = append(missing, issueCode)
+		}
+	}
+	return missing
+}
+
+func (c *CachedMASClient) ListBondInterests(ctx context.Context, issueCodes []string) (map[string]schemas.BondInterest, error) {
+	bondInterests := make(map[string]schemas.BondInterest, len(issueCodes))
+	missing := c.cachedBondInterests(issueCodes, bondInterests)
+	if len(missing) == 0 {
+		return bondInterests, nil
+	}
+
+	key := fmt.Sprint(missing)
+	fetch, done := c.singleflight("interests|" + key)
+	if !fetch {
+		// another caller fetched the same issue codes, anything still
+		// missing was not found or failed and is fetched again below
+		missing = c.cachedBondInterests(missing, bondInterests)
+		if len(missing) == 0 {
+			return bondInterests, nil
+		}
+		done = func() {}
+	}
+	defer done()
+
+	fetched, err := c.client.ListBondInterests(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	expiresAt := c.expiry(c.now(), c.config.BondInterestTTL)
+	for issueCode, bondInterest := range fetched {
+		c.bondInterests[issueCode] = masCacheEntry[schemas.BondInterest]{value: bondInterest, expiresAt: expiresAt}
+		bondInterests[issueCode] = bondInterest
+	}
+	c.mu.Unlock()
+	return bondInterests, nil
+}
+
+func startOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,200 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+)
+
+// countingMASClient counts the calls to it, and blocks each call until
+// release is closed, if set.
+type countingMASClient struct {
+	listBonds         atomic.Int32
+	listBondInterests atomic.Int32
+	started           chan struct{}
+	release           chan struct{}
+}
+
+func (c *countingMASClient) wait() {
+	if c.started != nil {
+		c.started <- struct{}{}
+	}
+	if c.release != nil {
+		<-c.release
+	}
+}
+
+func (c *countingMASClient) ListBonds(ctx context.Context, startDate time.Time, endDate time.Time, rows int) (*[]schemas.SavingsBonds, error) {
+	c.listBonds.Add(1)
+	c.wait()
+	return &[]schemas.SavingsBonds{{IssueCode: "SBNOV26"}}, nil
+}
+
+func (c *countingMASClient) GetBondInterest(ctx context.Context, issueCode string) (*schemas.BondInterest, error) {
+	panic("not used by CachedMASClient")
+}
+
+func (c *countingMASClient) ListBondInterests(ctx context.Context, issueCodes []string) (map[string]schemas.BondInterest, error) {
+	c.listBondInterests.Add(1)
+	c.wait()
+	bondInterests := make(map[string]schemas.BondInterest, len(issueCodes))
+	for _, issueCode := range issueCodes {
+		bondInterests[issueCode] = schemas.BondInterest{IssueCode: issueCode, Year1Coupon: 2}
+	}
+	return bondInterests, nil
+}
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestCachedMASClient(inner MASClient, now time.Time) (*CachedMASClient, *fakeClock) {
+	clock := &fakeClock{now: now}
+	c := NewCachedMASClient(inner, CachedMASClientConfig{
+		ListBondsTTL:    time.Hour,
+		BondInterestTTL: 6 * time.Hour,
+	})
+	c.now = clock.Now
+	c.Invalidate()
+	return c, clock
+}
+
+func TestCachedMASClientExpiresAfterTTL(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingMASClient{}
+	c, clock := newTestCachedMASClient(inner, time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC))
+	start, end := time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	for range 3 {
+		if _, err := c.ListBonds(ctx, start, end, 3); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls := inner.listBonds.Load(); calls != 1 {
+		t.Errorf("listed bonds %v times within the ttl, want once", calls)
+	}
+	// other arguments are cached separately
+	if _, err := c.ListBonds(ctx, start, end, 12); err != nil {
+		t.Fatal(err)
+	}
+	if calls := inner.listBonds.Load(); calls != 2 {
+		t.Errorf("listed bonds %v times, want twice", calls)
+	}
+	clock.Advance(time.Hour)
+	if _, err := c.ListBonds(ctx, start, end, 3); err != nil {
+		t.Fatal(err)
+	}
+	if calls := inner.listBonds.Load(); calls != 3 {
+		t.Errorf("listed bonds %v times after the ttl, want again", calls)
+	}
+
+	if _, err := c.ListBondInterests(ctx, []string{"SBOCT26", "SBNOV26"}); err != nil {
+		t.Fatal(err)
+	}
+	// only the issue code not cached yet is fetched
+	bondInterests, err := c.ListBondInterests(ctx, []string{"SBNOV26", "SBDEC26"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bondInterests) != 2 {
+		t.Errorf("got %v interest records, want 2", len(bondInterests))
+	}
+	if calls := inner.listBondInterests.Load(); calls != 2 {
+		t.Errorf("listed interests %v times, want twice", calls)
+	}
+	if _, err := c.GetBondInterest(ctx, "SBOCT26"); err != nil {
+		t.Fatal(err)
+	}
+	if calls := inner.listBondInterests.Load(); calls != 2 {
+		t.Errorf("listed interests %v times for a cached issue, want no more", calls)
+	}
+	clock.Advance(6 * time.Hour)
+	if _, err := c.GetBondInterest(ctx, "SBOCT26"); err != nil {
+		t.Fatal(err)
+	}
+	if calls := inner.listBondInterests.Load(); calls != 3 {
+		t.Errorf("listed interests %v times after the ttl, want again", calls)
+	}
+}
+
+func TestCachedMASClientFlushesAtStartOfMonth(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingMASClient{}
+	c, clock := newTestCachedMASClient(inner, time.Date(2026, 10, 31, 23, 30, 0, 0, time.UTC))
+	start, end := time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	if _, err := c.ListBonds(ctx, start, end, 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ListBondInterests(ctx, []string{"SBNOV26"}); err != nil {
+		t.Fatal(err)
+	}
+	// well within the ttls, but in the month the next issue is announced
+	clock.Advance(time.Minute * 31)
+	if _, err := c.ListBonds(ctx, start, end, 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ListBondInterests(ctx, []string{"SBNOV26"}); err != nil {
+		t.Fatal(err)
+	}
+	if calls := inner.listBonds.Load(); calls != 2 {
+		t.Errorf("listed bonds %v times across the month boundary, want twice", calls)
+	}
+	if calls := inner.listBondInterests.Load(); calls != 2 {
+		t.Errorf("listed interests %v times across the month boundary, want twice", calls)
+	}
+}
+
+func TestCachedMASClientCoalescesConcurrentFetches(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingMASClient{started: make(chan struct{}, 10), release: make(chan struct{})}
+	c, _ := newTestCachedMASClient(inner, time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC))
+	start, end := time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if bonds, err := c.ListBonds(ctx, start, end, 3); err != nil || len(*bonds) != 1 {
+				t.Errorf("listed %v, %v", bonds, err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if bondInterests, err := c.ListBondInterests(ctx, []string{"SBNOV26"}); err != nil || len(bondInterests) != 1 {
+				t.Errorf("listed %v, %v", bondInterests, err)
+			}
+		}()
+	}
+	// let every caller reach the fetch in flight before it returns
+	<-inner.started
+	<-inner.started
+	time.Sleep(50 * time.Millisecond)
+	close(inner.release)
+	wg.Wait()
+
+	if calls := inner.listBonds.Load(); calls != 1 {
+		t.Errorf("listed bonds %v times for 5 concurrent callers, want once", calls)
+	}
+	if calls := inner.listBondInterests.Load(); calls != 1 {
+		t.Errorf("listed interests %v times for 5 concurrent callers, want once", calls)
+	}
+}
@@ -0,0 +1,42 @@
+package core_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/core"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/masstub"
+)
+
+func TestPingReusesRecentRequests(t *testing.T) {
+	var requests atomic.Int32
+	stub := masstub.NewServer(masstub.DefaultFixtures())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		stub.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	masClient := core.NewMASClient(core.MASClientConfig{BaseURL: srv.URL})
+	ctx := context.Background()
+
+	for range 3 {
+		if err := masClient.Ping(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("pinging 3 times made %v requests, want 1", got)
+	}
+
+	if _, err := masClient.ListBonds(ctx, time.Now().AddDate(-1, 0, 0), time.Now(), 1); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+	if err := masClient.Ping(ctx); err != nil {
+		t.Errorf("ping after a recent successful request failed: %v", err)
+	}
+}
@@ -0,0 +1,348 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/metrics"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"github.com/vicanso/go-charts/v2"
+)
+
+func FormatSavingsBondNotification(bond schemas.SavingsBonds, bondInterests map[string]schemas.BondInterest) (string, error) {
+	issueCode := bond.IssueCode
+	interest, ok := bondInterests[issueCode]
+	if !ok {
+		return "", fmt.Errorf("savings bonds with issue code: %v not found", issueCode)
+	}
+	issueDate := time.Time(bond.IssueDate).Format("02 Jan 2006")
+	maturityDate := time.Time(bond.MaturityDate).Format("02 Jan 2006")
+	lastDayToApply := time.Time(bond.LastDayToApply).Format("02 Jan 2006")
+
+	message := fmt.Sprintf(
+		"🇸🇬 *Singapore Savings Bonds \\(%s\\)* 🇸🇬\n\n"+
+			"*Issue Code:* %s\n"+
+			"*Issue Date:* %s\n"+
+			"*Maturity Date:* %s\n"+
+			"*Last Day to Apply:* %s\n\n"+
+			"*1\\-Year Average Return:* %.2f%%\n"+
+			"*10\\-Year Average Return:* %.2f%%\n\n"+
+			"*Key Dates:*\n"+
+			"\\- First Interest Date: %s\n"+
+			"\\- Interest Payment Months: %s\n\n"+
+			"*Additional Information:*\n"+
+			"\\- Issue Size: %.2f Million SGD\n",
+		issueCode,
+		issueCode,
+		issueDate,
+		maturityDate,
+		lastDayToApply,
+		interest.ReturnAt(1),
+		interest.ReturnAt(schemas.BondTenorYears),
+		time.Time(bond.FirstInterestDate).Format("02 Jan 2006"),
+		bond.PaymentMonth,
+		bond.IssueSize,
+	)
+	message = strings.Replace(message, ".", "\\.", -1)
+	return message, nil
+}
+
+// GenerateSSBInterestRatesChart plots the 10-year average return of each bond,
+// in the order given, using the interest records keyed by issue code.
+func GenerateSSBInterestRatesChart(bonds []schemas.SavingsBonds, bondInterests map[string]schemas.BondInterest) (*[]byte, error) {
+	timer := prometheus.NewTimer(metrics.ChartRenderDuration)
+	defer timer.ObserveDuration()
+	var interestRates []float64
+	var dates []string
+	for _, bond := range bonds {
+		bondInterest, ok := bondInterests[bond.IssueCode]
+		if !ok {
+			return nil, fmt.Errorf("savings bonds with issue code: %v not found", bond.IssueCode)
+		}
+		interestRates = append(interestRates, bondInterest.ReturnAt(schemas.BondTenorYears))
+		dates = append(dates, time.Time(bond.IssueDate).Format("Jan 06"))
+	}
+
+	chartOption := charts.ChartOption{
+		Width:  1000,
+		Height: 400,
+		SeriesList: []charts.Series{
+			{
+				Type:  charts.ChartTypeLine,
+				Data:  charts.NewSeriesDataFromValues(interestRates),
+				Label: charts.SeriesLabel{Show: *charts.TrueFlag()},
+			}},
+		Title: charts.TitleOption{
+			Text: "Singapore Savings Bonds 10-Year Average Returns",
+		},
+		Padding: charts.Box{
+			Top:    20,
+			Left:   20,
+			Right:  20,
+			Bottom: 20,
+		},
+		Legend: charts.NewLegendOption([]string{
+			"Interest Rates",
+		}, charts.PositionRight),
+		XAxis: charts.NewXAxisOption(dates),
+		ValueFormatter: func(f float64) string {
+			return fmt.Sprintf("%.00f", f) + "%"
+		},
+	}
+	p, err := charts.Render(chartOption)
+
+	if err != nil {
+		return nil, err
+	}
+
+	buf, err := p.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// Notification is the rendered SSB rates message, shared by every chat it is sent to.
+type Notification struct {
+	IssueCode string // issue code of the latest bond described in the caption
+	Caption   string
+	Chart     []byte
+	Curve     []byte // coupon curve of the latest bond, nil unless rendered
+}
+
+// listChartedBonds returns the 12 bonds up to the one LatestIssue returns,
+// latest first.
+func listChartedBonds(ctx context.Context, masClient MASClient, timezone *time.Location) ([]schemas.SavingsBonds, error) {
+	latestBond, err := LatestIssue(ctx, masClient, timezone)
+	if err != nil {
+		return nil, err
+	}
+	latestIssueDate := time.Time(latestBond.IssueDate)
+	bondsPtr, err := masClient.ListBonds(ctx, latestIssueDate.AddDate(-1, 0, 0), latestIssueDate, 12)
+	if err != nil {
+		return nil, err
+	}
+	bonds := *bondsPtr
+
+	if len(bonds) == 0 || bonds[0].IssueCode != latestBond.IssueCode {
+		return nil, fmt.Errorf("latest issue %v not found in the mas bond listing", latestBond.IssueCode)
+	}
+	return bonds, nil
+}
+
+func renderNotification(ctx context.Context, masClient MASClient, bonds []schemas.SavingsBonds, withCurve bool) (*Notification, error) {
+	latestBond := bonds[0]
+	// chart from oldest to latest
+	bonds = append([]schemas.SavingsBonds(nil), bonds...)
+	issueCodes := make([]string, len(bonds))
+	for i := len(bonds)/2 - 1; i >= 0; i-- {
+		opp := len(bonds) - 1 - i
+		bonds[i], bonds[opp] = bonds[opp], bonds[i]
+	}
+	for i, bond := range bonds {
+		issueCodes[i] = bond.IssueCode
+	}
+
+	bondInterests, err := masClient.ListBondInterests(ctx, issueCodes)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := GenerateSSBInterestRatesChart(bonds, bondInterests)
+	if err != nil {
+		return nil, err
+	}
+	caption, err := FormatSavingsBondNotification(latestBond, bondInterests)
+	if err != nil {
+		return nil, err
+	}
+	notification := &Notification{
+		IssueCode: latestBond.IssueCode,
+		Caption:   caption,
+		Chart:     *buf,
+	}
+	if withCurve {
+		// the charted bonds are a month apart, so the one before the latest
+		// is the previous issue
+		var previous *schemas.BondInterest
+		if len(bonds) > 1 {
+			if previousInterest, ok := bondInterests[bonds[len(bonds)-2].IssueCode]; ok {
+				previous = &previousInterest
+			}
+		}
+		curve, err := GenerateCouponCurveChart(bondInterests[latestBond.IssueCode], previous)
+		if err != nil {
+			return nil, err
+		}
+		notification.Curve = *curve
+	}
+	return notification, nil
+}
+
+// Notifier renders the SSB rates notification once and uploads its chart once,
+// then sends every other chat the Telegram file_id of the uploaded photo. The
+// notification is rendered again when a new bond is issued. With attachCurve,
+// the coupon curve of the latest bond is sent along with the chart as a media
+// group.
+type Notifier struct {
+	masClient   MASClient
+	timezone    *time.Location
+	attachCurve bool
+
+	mu           sync.Mutex
+	notification *Notification
+	fileID       string
+	curveFileID  string
+}
+
+func NewNotifier(masClient MASClient, timezone *time.Location, attachCurve bool) *Notifier {
+	return &Notifier{
+		masClient:   masClient,
+		timezone:    timezone,
+		attachCurve: attachCurve,
+	}
+}
+
+// Notification returns the current notification, rendering it if the latest
+// bond has changed since it was last rendered.
+func (n *Notifier) Notification(ctx context.Context) (*Notification, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.current(ctx)
+}
+
+// current must be called with n.mu held.
+func (n *Notifier) current(ctx context.Context) (*Notification, error) {
+	bonds, err := listChartedBonds(ctx, n.masClient, n.timezone)
+	if err != nil {
+		return nil, err
+	}
+	if n.notification != nil && n.notification.IssueCode == bonds[0].IssueCode {
+		return n.notification, nil
+	}
+	notification, err := renderNotification(ctx, n.masClient, bonds, n.attachCurve)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("rendered notification for %v", notification.IssueCode)
+	n.notification = notification
+	n.fileID = ""
+	n.curveFileID = ""
+	return notification, nil
+}
+
+// Send sends the current notification to chatID. The first send after a
+// render uploads the chart and holds the lock until Telegram returns its
+// file_id, so concurrent senders never upload the same chart twice.
+func (n *Notifier) Send(ctx context.Context, sender Sender, chatID int64) (tgbotapi.Message, error) {
+	n.mu.Lock()
+	notification, err := n.current(ctx)
+	if err != nil {
+		n.mu.Unlock()
+		return tgbotapi.Message{}, err
+	}
+	return n.send(sender, chatID, notification)
+}
+
+// SendNotification sends notification, as returned by Notification, to
+// chatID the same way Send does, without looking for a newer bond first. Any
+// error is from Telegram.
+func (n *Notifier) SendNotification(sender Sender, chatID int64, notification *Notification) (tgbotapi.Message, error) {
+	n.mu.Lock()
+	return n.send(sender, chatID, notification)
+}
+
+// send must be called with n.mu held, and releases it. The uploaded file_ids
+// are only reused and kept for the current notification.
+func (n *Notifier) send(sender Sender, chatID int64, notification *Notification) (tgbotapi.Message, error) {
+	current := notification == n.notification
+	if notification.Curve != nil {
+		return n.sendWithCurve(sender, chatID, notification, current)
+	}
+	if current && n.fileID != "" {
+		fileID := n.fileID
+		n.mu.Unlock()
+		return sender.Send(notificationPhoto(chatID, notification, tgbotapi.FileID(fileID)))
+	}
+	if current {
+		defer n.mu.Unlock()
+	} else {
+		// rendered again since, the file_id kept is of the newer notification
+		n.mu.Unlock()
+	}
+
+	message, err := sender.Send(notificationPhoto(chatID, notification, tgbotapi.FileBytes{
+		Name:  "picture",
+		Bytes: notification.Chart,
+	}))
+	if err != nil {
+		return message, err
+	}
+	if current {
+		n.fileID = uploadedFileID(message)
+	}
+	return message, nil
+}
+
+// sendWithCurve sends the chart and the coupon curve of notification as a
+// media group, the same way send sends the chart alone. It must be called
+// with n.mu held, and releases it.
+func (n *Notifier) sendWithCurve(sender Sender, chatID int64, notification *Notification, current bool) (tgbotapi.Message, error) {
+	if current && n.fileID != "" && n.curveFileID != "" {
+		fileID, curveFileID := n.fileID, n.curveFileID
+		n.mu.Unlock()
+		return sendMediaGroup(sender, notificationMediaGroup(chatID, notification, tgbotapi.FileID(fileID), tgbotapi.FileID(curveFileID)))
+	}
+	if current {
+		defer n.mu.Unlock()
+	} else {
+		n.mu.Unlock()
+	}
+
+	messages, err := sendMediaGroupMessages(sender, notificationMediaGroup(chatID, notification, tgbotapi.FileBytes{
+		Name:  "picture",
+		Bytes: notification.Chart,
+	}, tgbotapi.FileBytes{
+		Name:  "curve",
+		Bytes: notification.Curve,
+	}))
+	if err != nil {
+		return tgbotapi.Message{}, err
+	}
+	if current && len(messages) == 2 {
+		n.fileID = uploadedFileID(messages[0])
+		n.curveFileID = uploadedFileID(messages[1])
+	}
+	return messages[0], nil
+}
+
+// uploadedFileID returns the file_id of the photo in message, if any.
+func uploadedFileID(message tgbotapi.Message) string {
+	if len(message.Photo) == 0 {
+		return ""
+	}
+	// the last photo size is the original upload
+	return message.Photo[len(message.Photo)-1].FileID
+}
+
+func notificationMediaGroup(chatID int64, notification *Notification, chart tgbotapi.RequestFileData, curve tgbotapi.RequestFileData) tgbotapi.MediaGroupConfig {
+	chartPhoto := tgbotapi.NewInputMediaPhoto(chart)
+	// telegram shows the caption of the first photo under the group
+	chartPhoto.Caption = notification.Caption
+	chartPhoto.ParseMode = "MarkdownV2"
+	return tgbotapi.NewMediaGroup(chatID, []interface{}{chartPhoto, tgbotapi.NewInputMediaPhoto(curve)})
+}
+
+func notificationPhoto(chatID int64, notification *Notification, file tgbotapi.RequestFileData) tgbotapi.PhotoConfig {
+	photoConfig := tgbotapi.NewPhoto(chatID, file)
+
+	// add message information on the latest bond
+	photoConfig.Caption = notification.Caption
+	photoConfig.ParseMode = "MarkdownV2"
+	return photoConfig
+}
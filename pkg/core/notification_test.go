@@ -0,0 +1,39 @@
+package core_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/core"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/masstub"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+)
+
+func TestNotificationDescribesLatestAnnouncedIssue(t *testing.T) {
+	ctx := context.Background()
+	timezone := time.UTC
+	now := time.Now().In(timezone)
+	fixtures := masstub.DefaultFixtures().ShiftTo(now.AddDate(0, 1, 0))
+	// next month's issue is listed ahead of its announcement tomorrow
+	fixtures.Bonds[0].AnnDate = schemas.BondDate(now.AddDate(0, 0, 1))
+	srv := httptest.NewServer(masstub.NewServer(fixtures))
+	defer srv.Close()
+	masClient := core.NewMASClient(core.MASClientConfig{BaseURL: srv.URL})
+
+	latestBond, err := core.LatestIssue(ctx, masClient, timezone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latestBond.IssueCode != fixtures.Bonds[1].IssueCode {
+		t.Fatalf("latest issue is %v, want the announced %v", latestBond.IssueCode, fixtures.Bonds[1].IssueCode)
+	}
+	notification, err := core.NewNotifier(masClient, timezone, false).Notification(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notification.IssueCode != latestBond.IssueCode {
+		t.Errorf("notification describes %v, want the latest issue %v", notification.IssueCode, latestBond.IssueCode)
+	}
+}
@@ -0,0 +1,165 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+)
+
+// redemptionRequestBusinessDaysBeforeMonthEnd is how many business days
+// before the end of a month, counting the last, redemption requests close.
+const redemptionRequestBusinessDaysBeforeMonthEnd = 4
+
+// redemptionPaymentBusinessDay is the business day of the month a bond is
+// redeemed in that the cash arrives by.
+const redemptionPaymentBusinessDay = 2
+
+// isBusinessDay reports whether date is a weekday. Public holidays are not
+// known, so dates worked out from business days may be a day or two early.
+func isBusinessDay(date time.Time) bool {
+	return date.Weekday() != time.Saturday && date.Weekday() != time.Sunday
+}
+
+// nthBusinessDay returns the nth business day of the month of date.
+func nthBusinessDay(date time.Time, n int) time.Time {
+	day := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, date.Location())
+	for {
+		if isBusinessDay(day) {
+			n--
+			if n == 0 {
+				return day
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+}
+
+// nthLastBusinessDay returns the nth last business day of the month of date.
+func nthLastBusinessDay(date time.Time, n int) time.Time {
+	day := time.Date(date.Year(), date.Month()+1, 0, 0, 0, 0, 0, date.Location())
+	for {
+		if isBusinessDay(day) {
+			n--
+			if n == 0 {
+				return day
+			}
+		}
+		day = day.AddDate(0, 0, -1)
+	}
+}
+
+func monthOf(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// monthsBetween returns the number of whole months from start to end, so
+// years of bonds count the same whether or not they span a Feb 29.
+func monthsBetween(start, end time.Time) int {
+	months := (end.Year()-start.Year())*12 + int(end.Month()-start.Month())
+	if end.Day() < start.Day() {
+		months--
+	}
+	return months
+}
+
+// Redemption is what redeeming a holding in a month works out to.
+type Redemption struct {
+	IssueCode        string
+	Principal        int
+	RequestDeadline  time.Time // last day to request the redemption in the month
+	RedemptionDate   time.Time // first day of the following month
+	PaymentDate      time.Time // the cash arrives by this date
+	CouponsReceived  float64   // coupons paid before the redemption
+	CouponPayments   int
+	AccruedInterest  float64 // interest since the last coupon, paid with the principal
+	YearsHeld        float64
+	EffectiveReturn  float64 // annualized return achieved, in percent
+	AdvertisedYear   int     // year of the bond the redemption falls in
+	AdvertisedReturn float64 // average return per year advertised for holding to the end of AdvertisedYear, in percent
+}
+
+// CalculateRedemption works out redeeming principal dollars of bond with a
+// request made in month. Bonds are redeemed on the first day of the following
+// month, with the interest accrued since the last coupon at the year's coupon
+// rate on an actual/365 basis.
+func CalculateRedemption(bond schemas.SavingsBonds, interest schemas.BondInterest, principal int, month time.Time) (*Redemption, error) {
+	month = monthOf(month)
+	if start := time.Time(bond.StartOfRedemption); !start.IsZero() && month.Before(monthOf(start)) {
+		return nil, fmt.Errorf("%v can only be redeemed from %v", bond.IssueCode, start.Format("Jan 2006"))
+	}
+	if end := time.Time(bond.EndOfRedemption); !end.IsZero() && month.After(monthOf(end)) {
+		return nil, fmt.Errorf("%v can only be redeemed until %v", bond.IssueCode, end.Format("Jan 2006"))
+	}
+
+	issueDate := time.Time(bond.IssueDate)
+	redemptionDate := month.AddDate(0, 1, 0)
+	redemption := &Redemption{
+		IssueCode:       bond.IssueCode,
+		Principal:       principal,
+		RequestDeadline: nthLastBusinessDay(month, redemptionRequestBusinessDaysBeforeMonthEnd),
+		RedemptionDate:  redemptionDate,
+		PaymentDate:     nthBusinessDay(redemptionDate, redemptionPaymentBusinessDay),
+	}
+
+	lastPaymentDate := issueDate
+	for _, payment := range CouponSchedule(bond, interest, principal) {
+		if payment.Date.After(redemptionDate) {
+			break
+		}
+		redemption.CouponsReceived += payment.Amount
+		redemption.CouponPayments++
+		lastPaymentDate = payment.Date
+	}
+	monthsHeld := monthsBetween(issueDate, redemptionDate)
+	yearsHeld := float64(monthsHeld) / 12
+	year := min(max((monthsHeld+11)/12, 1), schemas.BondTenorYears)
+	accruedDays := redemptionDate.Sub(lastPaymentDate).Hours() / 24
+	redemption.AccruedInterest = float64(principal) * interest.CouponAt(year) / 100 * accruedDays / 365
+
+	redemption.YearsHeld = yearsHeld
+	redemption.AdvertisedYear = year
+	redemption.AdvertisedReturn = interest.ReturnAt(year)
+	totalInterest := redemption.CouponsReceived + redemption.AccruedInterest
+	if yearsHeld > 0 {
+		// not compounded, like the advertised returns which average the coupons
+		redemption.EffectiveReturn = totalInterest / float64(principal) / yearsHeld * 100
+	}
+	return redemption, nil
+}
+
+// RedemptionWindowOpen reports whether a redemption of bond can be requested
+// on now, and until when.
+func RedemptionWindowOpen(bond schemas.SavingsBonds, now time.Time) (bool, time.Time) {
+	month := monthOf(now)
+	deadline := nthLastBusinessDay(month, redemptionRequestBusinessDaysBeforeMonthEnd)
+	if start := time.Time(bond.StartOfRedemption); !start.IsZero() && month.Before(monthOf(start)) {
+		return false, deadline
+	}
+	if end := time.Time(bond.EndOfRedemption); !end.IsZero() && month.After(monthOf(end)) {
+		return false, deadline
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return !today.After(deadline), deadline
+}
+
+// FormatRedemption returns the MarkdownV2 summary of a redemption.
+func FormatRedemption(redemption Redemption, windowOpen bool, windowDeadline time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "🏦 *Redeeming %s of %s* 🏦\n\n", FormatDollars(float64(redemption.Principal)), redemption.IssueCode)
+	fmt.Fprintf(&b, "*Request By:* %s\n", redemption.RequestDeadline.Format("02 Jan 2006"))
+	fmt.Fprintf(&b, "*Redeemed On:* %s\n", redemption.RedemptionDate.Format("02 Jan 2006"))
+	fmt.Fprintf(&b, "*Cash Arrives By:* %s\n\n", redemption.PaymentDate.Format("02 Jan 2006"))
+	fmt.Fprintf(&b, "*Coupons Received:* %s over %v payments\n", FormatDollars(redemption.CouponsReceived), redemption.CouponPayments)
+	fmt.Fprintf(&b, "*Accrued Interest:* %s\n", FormatDollars(redemption.AccruedInterest))
+	fmt.Fprintf(&b, "*Paid on Redemption:* %s\n\n", FormatDollars(float64(redemption.Principal)+redemption.AccruedInterest))
+	fmt.Fprintf(&b, "*Effective Return:* %.2f%% a year over %.1f years\n", redemption.EffectiveReturn, redemption.YearsHeld)
+	fmt.Fprintf(&b, "*Advertised Return:* %.2f%% a year if held to the end of year %v\n\n", redemption.AdvertisedReturn, redemption.AdvertisedYear)
+	if windowOpen {
+		fmt.Fprintf(&b, "The redemption window is open this month until %s.\n", windowDeadline.Format("02 Jan 2006"))
+	} else {
+		b.WriteString("The redemption window is closed this month.\n")
+	}
+	return strings.Replace(b.String(), ".", "\\.", -1)
+}
@@ -0,0 +1,96 @@
+package core_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/core"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// testBond returns a bond issued on issueDate that pays interest every six
+// months and steps up from a 2% coupon by 0.1% a year.
+func testBond(issueCode string, issueDate time.Time) (schemas.SavingsBonds, schemas.BondInterest) {
+	bond := schemas.SavingsBonds{
+		IssueCode:         issueCode,
+		IssueDate:         schemas.BondDate(issueDate),
+		FirstInterestDate: schemas.BondDate(issueDate.AddDate(0, 6, 0)),
+		MaturityDate:      schemas.BondDate(issueDate.AddDate(schemas.BondTenorYears, 0, 0)),
+	}
+	interest := schemas.BondInterest{IssueCode: issueCode}
+	coupons := []*float64{
+		&interest.Year1Coupon, &interest.Year2Coupon, &interest.Year3Coupon, &interest.Year4Coupon, &interest.Year5Coupon,
+		&interest.Year6Coupon, &interest.Year7Coupon, &interest.Year8Coupon, &interest.Year9Coupon, &interest.Year10Coupon,
+	}
+	returns := []*float64{
+		&interest.Year1Return, &interest.Year2Return, &interest.Year3Return, &interest.Year4Return, &interest.Year5Return,
+		&interest.Year6Return, &interest.Year7Return, &interest.Year8Return, &interest.Year9Return, &interest.Year10Return,
+	}
+	total := 0.0
+	for i := range coupons {
+		*coupons[i] = 2 + 0.1*float64(i)
+		total += *coupons[i]
+		*returns[i] = total / float64(i+1)
+	}
+	return bond, interest
+}
+
+func TestRedemptionOfWholeYearsSpanningLeapDays(t *testing.T) {
+	bond, interest := testBond("SBMAR23", date(2023, 3, 1))
+	// redeemed on 1 Mar 2028, five years after issue and after two Feb 29s
+	redemption, err := core.CalculateRedemption(bond, interest, 10000, date(2028, 2, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redemption.AdvertisedYear != 5 {
+		t.Errorf("advertised year is %v, want 5", redemption.AdvertisedYear)
+	}
+	if redemption.AdvertisedReturn != interest.Year5Return {
+		t.Errorf("advertised return is %v, want the year 5 return %v", redemption.AdvertisedReturn, interest.Year5Return)
+	}
+	if redemption.YearsHeld != 5 {
+		t.Errorf("held for %v years, want 5", redemption.YearsHeld)
+	}
+	if redemption.CouponPayments != 10 {
+		t.Errorf("received %v coupons, want 10", redemption.CouponPayments)
+	}
+	if redemption.AccruedInterest != 0 {
+		t.Errorf("accrued %v of interest on a coupon date, want none", redemption.AccruedInterest)
+	}
+}
+
+func TestRedemptionPartWayThroughAYear(t *testing.T) {
+	bond, interest := testBond("SBMAR23", date(2023, 3, 1))
+	// redeemed on 1 Sep 2025, two and a half years after issue
+	redemption, err := core.CalculateRedemption(bond, interest, 10000, date(2025, 8, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redemption.AdvertisedYear != 3 {
+		t.Errorf("advertised year is %v, want 3", redemption.AdvertisedYear)
+	}
+	if redemption.YearsHeld != 2.5 {
+		t.Errorf("held for %v years, want 2.5", redemption.YearsHeld)
+	}
+	if redemption.CouponPayments != 5 {
+		t.Errorf("received %v coupons, want 5", redemption.CouponPayments)
+	}
+	if got, want := redemption.RequestDeadline, date(2025, 8, 26); !got.Equal(want) {
+		t.Errorf("request deadline is %v, want %v", got.Format(time.DateOnly), want.Format(time.DateOnly))
+	}
+	if got, want := redemption.PaymentDate, date(2025, 9, 2); !got.Equal(want) {
+		t.Errorf("payment date is %v, want %v", got.Format(time.DateOnly), want.Format(time.DateOnly))
+	}
+}
+
+func TestRedemptionOutsideWindow(t *testing.T) {
+	bond, interest := testBond("SBMAR23", date(2023, 3, 1))
+	bond.StartOfRedemption = schemas.BondDate(date(2023, 4, 1))
+	if _, err := core.CalculateRedemption(bond, interest, 10000, date(2023, 3, 1)); err == nil {
+		t.Error("expected an error redeeming before the start of redemption")
+	}
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+	log "github.com/sirupsen/logrus"
+)
+
+// MaxReminderDays is the furthest ahead of the last day to apply a chat can
+// ask to be reminded, about the length of an application window.
+const MaxReminderDays = 14
+
+// FormatReminder returns the MarkdownV2 reminder that applications for bond
+// close in daysLeft days.
+func FormatReminder(bond schemas.SavingsBonds, interest schemas.BondInterest, daysLeft int) string {
+	closing := fmt.Sprintf("in %v days", daysLeft)
+	switch daysLeft {
+	case 0:
+		closing = "today"
+	case 1:
+		closing = "tomorrow"
+	}
+	message := fmt.Sprintf(
+		"⏰ *Applications for %s close %s* ⏰\n\n"+
+			"*Last Day to Apply:* %s\n"+
+			"*1\\-Year Average Return:* %.2f%%\n"+
+			"*10\\-Year Average Return:* %.2f%%\n",
+		bond.IssueCode,
+		closing,
+		time.Time(bond.LastDayToApply).Format("02 Jan 2006"),
+		interest.ReturnAt(1),
+		interest.ReturnAt(schemas.BondTenorYears),
+	)
+	return strings.Replace(message, ".", "\\.", -1)
+}
+
+// daysUntil returns the number of calendar days from now to date in the
+// timezone, negative once date has passed.
+func daysUntil(now time.Time, date time.Time, timezone *time.Location) int {
+	now = now.In(timezone)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	return int(day.Sub(today).Hours() / 24)
+}
+
+// SendReminders reminds every chat with ReminderDays set that the latest
+// issue's applications close soon, once per issue. A chat is reminded on the
+// first run within its ReminderDays of the last day to apply.
+func (s *Scheduler) SendReminders(ctx context.Context) error {
+	var latestBond *schemas.SavingsBonds
+	err := Retry(ctx, DefaultRetryPolicy, "get latest issue", func() (err error) {
+		latestBond, err = LatestIssue(ctx, s.MASClient, s.Timezone)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	lastDayToApply := time.Time(latestBond.LastDayToApply)
+	if lastDayToApply.IsZero() {
+		return nil
+	}
+	daysLeft := daysUntil(time.Now(), lastDayToApply, s.Timezone)
+	if daysLeft < 0 || daysLeft > MaxReminderDays {
+		return nil
+	}
+
+	issueCode := latestBond.IssueCode
+	var chats []schemas.ChatSettings
+	err = Retry(ctx, DefaultRetryPolicy, "get users to remind", func() (err error) {
+		chats, err = s.Repository.GetUsersToRemind(ctx, issueCode)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	var chatIdsToRemind []int64
+	for _, chat := range chats {
+		if chat.ReminderDays >= daysLeft {
+			chatIdsToRemind = append(chatIdsToRemind, chat.ChatId)
+		}
+	}
+	if len(chatIdsToRemind) == 0 {
+		return nil
+	}
+
+	var interest *schemas.BondInterest
+	err = Retry(ctx, DefaultRetryPolicy, fmt.Sprintf("get interest of %v", issueCode), func() (err error) {
+		interest, err = s.MASClient.GetBondInterest(ctx, issueCode)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	reminder := FormatReminder(*latestBond, *interest, daysLeft)
+
+	log.Infof("reminding %v chats of %v", len(chatIdsToRemind), issueCode)
+	s.Broadcaster.Broadcast(ctx, chatIdsToRemind, func(chatId int64) {
+		err := s.sendMessageToChat(ctx, chatId, reminder, func(chatSettings *schemas.ChatSettings) {
+			chatSettings.LatestSSBIssueReminded = issueCode
+		})
+		if err != nil {
+			log.Errorf("error reminding chat %v of %v (%v): %v", chatId, issueCode, ClassifyTelegramError(err), err)
+		}
+	})
+	return nil
+}
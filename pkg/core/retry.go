@@ -0,0 +1,71 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 1 * time.Second,
+	MaxBackoff:     30 * time.Second,
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// IsPermanent reports whether retrying the call that returned err cannot succeed,
+// either because it was marked with Permanent or telegram rejected it for good.
+func IsPermanent(err error) bool {
+	var permanent permanentError
+	if errors.As(err, &permanent) {
+		return true
+	}
+	return ClassifyTelegramError(err).IsPermanent()
+}
+
+// Retry calls fn until it succeeds, returns a permanent error or the policy
+// runs out of attempts or ctx is done, doubling the wait between attempts. Telegram flood
+// control errors wait for the retry_after telegram asked for instead.
+func Retry(ctx context.Context, policy RetryPolicy, description string, fn func() error) error {
+	backoff := policy.InitialBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || IsPermanent(err) || attempt >= policy.MaxAttempts {
+			return err
+		}
+		wait := backoff
+		if retryAfter := TelegramRetryAfter(err); retryAfter > 0 {
+			wait = retryAfter
+		}
+		log.Warnf("attempt %v/%v to %v failed, retrying in %v: %v", attempt, policy.MaxAttempts, description, wait, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		backoff = min(backoff*2, policy.MaxBackoff)
+	}
+}
@@ -1,250 +1,279 @@
 package core
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
-	"strings"
 	"sync"
 	"time"
 
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/metrics"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/repository"
 	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	log "github.com/sirupsen/logrus"
-	"github.com/vicanso/go-charts/v2"
 )
 
-func ListBonds(startDate time.Time, endDate time.Time, rows int) (*[]schemas.SavingsBonds, error) {
-	queryParams := fmt.Sprintf("rows=%v&filters=issue_date:[%v+TO+%v]&sort=issue_date+desc", rows, startDate.Format(time.DateOnly), endDate.Format(time.DateOnly))
-	endpoint := fmt.Sprintf("%v?%v", "https://eservices.mas.gov.sg/statistics/api/v1/bondsandbills/m/listsavingbonds", queryParams)
+// Scheduler runs the periodic jobs of the bot.
+type Scheduler struct {
+	Sender      Sender
+	Repository  repository.Repository
+	MASClient   MASClient
+	Notifier    *Notifier
+	Broadcaster *Broadcaster
+	Timezone    *time.Location
+	Schedules   JobSchedules
 
-	log.Debugf("querying %v", endpoint)
+	mu sync.Mutex
+	// unsavedNotifications are the outcomes of sends the outbox could not be
+	// updated with, by chat id. The outbox still has them in flight.
+	unsavedNotifications map[int64]schemas.OutboxEntry
+}
 
-	req, httpErr := http.NewRequest(http.MethodGet, endpoint, nil)
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:135.0) Gecko/20100101 Firefox/135.0") // need to set user-agent if not will throw 403 error
-	if httpErr != nil {
-		return nil, httpErr
-	}
-	client := &http.Client{}
-	res, httpErr := client.Do(req)
-	if httpErr != nil {
-		return nil, httpErr
-	}
-	defer res.Body.Close()
-	body, _ := io.ReadAll(res.Body)
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("status code %v error listing bonds from mas api: %v", res.StatusCode, string(body))
+// LatestIssue returns the most recently announced bond. MAS lists a bond as
+// soon as it is announced, about a month before it is issued.
+func LatestIssue(ctx context.Context, masClient MASClient, localTimezone *time.Location) (*schemas.SavingsBonds, error) {
+	now := time.Now().In(localTimezone)
+	bondsPtr, err := masClient.ListBonds(ctx, now.AddDate(0, -2, 0), now.AddDate(0, 2, 0), 3)
+	if err != nil {
+		return nil, err
 	}
-	var savingsBondsAPIResponse schemas.ListSavingsBondsResponse
-	jsonErr := json.Unmarshal(body, &savingsBondsAPIResponse)
-	// error handling for json unmarshaling
-	if jsonErr != nil {
-		return nil, jsonErr
+	for _, bond := range *bondsPtr {
+		annDate := time.Time(bond.AnnDate)
+		if !annDate.IsZero() && annDate.After(now) {
+			// listed ahead of its announcement date
+			continue
+		}
+		return &bond, nil
 	}
-
-	return &savingsBondsAPIResponse.Result.Records, nil
+	return nil, fmt.Errorf("no savings bonds announced between %v and %v", now.AddDate(0, -2, 0).Format(time.DateOnly), now.AddDate(0, 2, 0).Format(time.DateOnly))
 }
 
-func ListBondInterestRates(bond schemas.SavingsBonds) (*schemas.BondInterest, error) {
-	endpoint := fmt.Sprintf("https://eservices.mas.gov.sg/statistics/api/v1/bondsandbills/m/savingbondsinterest?filters=issue_code:%v", bond.IssueCode)
+// maxNotificationAttempts is how many broadcasts may fail to notify a chat of
+// an issue before it is given up on.
+const maxNotificationAttempts = 5
 
-	log.Debugf("querying %v", endpoint)
+// inFlightTimeout is how long a notification may be in flight before the send
+// is taken to have been interrupted. It is well above the time a send with
+// retries takes.
+const inFlightTimeout = 15 * time.Minute
 
-	req, httpErr := http.NewRequest(http.MethodGet, endpoint, nil)
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:135.0) Gecko/20100101 Firefox/135.0") // need to set user-agent if not will throw 403 error
-	if httpErr != nil {
-		return nil, httpErr
-	}
-	client := &http.Client{}
-	res, httpErr := client.Do(req)
-	if httpErr != nil {
-		return nil, httpErr
-	}
-	defer res.Body.Close()
-	body, _ := io.ReadAll(res.Body)
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("status code %v error listing bonds from mas api: %v", res.StatusCode, string(body))
-	}
-	var savingsBondsInterestsAPIResponse schemas.ListSavingsBondsInterestResponse
-	jsonErr := json.Unmarshal(body, &savingsBondsInterestsAPIResponse)
-	// error handling for json unmarshaling
-	if jsonErr != nil {
-		return nil, jsonErr
-	}
-
-	if len(savingsBondsInterestsAPIResponse.Result.Records) == 0 {
-		return nil, fmt.Errorf("savings bonds with issue code: %v not found", bond.IssueCode)
-	}
-	return &savingsBondsInterestsAPIResponse.Result.Records[0], nil
+// since returns how long ago t was. Times are stored without a timezone, as
+// the wall clock in s.Timezone.
+func (s *Scheduler) since(t schemas.DatetimeWithoutTimezone) time.Duration {
+	wallClock := time.Time(t)
+	return time.Since(time.Date(wallClock.Year(), wallClock.Month(), wallClock.Day(),
+		wallClock.Hour(), wallClock.Minute(), wallClock.Second(), wallClock.Nanosecond(), s.Timezone))
 }
 
-func FormatSavingsBondNotification(bond schemas.SavingsBonds, interest schemas.BondInterest) string {
-	issueCode := bond.IssueCode
-	issueDate := time.Time(bond.IssueDate).Format("02 Jan 2006")
-	maturityDate := time.Time(bond.MaturityDate).Format("02 Jan 2006")
-	lastDayToApply := time.Time(bond.LastDayToApply).Format("02 Jan 2006")
-
-	message := fmt.Sprintf(
-		"🇸🇬 *Singapore Savings Bonds \\(%s\\)* 🇸🇬\n\n"+
-			"*Issue Code:* %s\n"+
-			"*Issue Date:* %s\n"+
-			"*Maturity Date:* %s\n"+
-			"*Last Day to Apply:* %s\n\n"+
-			"*1\\-Year Average Return:* %.2f%%\n"+
-			"*10\\-Year Average Return:* %.2f%%\n\n"+
-			"*Key Dates:*\n"+
-			"\\- First Interest Date: %s\n"+
-			"\\- Interest Payment Months: %s\n\n"+
-			"*Additional Information:*\n"+
-			"\\- Issue Size: %.2f Million SGD\n",
-		issueCode,
-		issueCode,
-		issueDate,
-		maturityDate,
-		lastDayToApply,
-		interest.Year1Return,
-		interest.Year10Return,
-		time.Time(bond.FirstInterestDate).Format("02 Jan 2006"),
-		bond.PaymentMonth,
-		bond.IssueSize,
-	)
-	message = strings.Replace(message, ".", "\\.", -1)
-	return message
-}
-
-func GenerateSSBInterestRatesChart(interestRates []float64, dates []string) (*[]byte, error) {
-	chartOption := charts.ChartOption{
-		Width:  1000,
-		Height: 400,
-		SeriesList: []charts.Series{
-			{
-				Type:  charts.ChartTypeLine,
-				Data:  charts.NewSeriesDataFromValues(interestRates),
-				Label: charts.SeriesLabel{Show: *charts.TrueFlag()},
-			}},
-		Title: charts.TitleOption{
-			Text: "Singapore Savings Bonds 10-Year Average Returns",
-		},
-		Padding: charts.Box{
-			Top:    20,
-			Left:   20,
-			Right:  20,
-			Bottom: 20,
-		},
-		Legend: charts.NewLegendOption([]string{
-			"Interest Rates",
-		}, charts.PositionRight),
-		XAxis: charts.NewXAxisOption(dates),
-		ValueFormatter: func(f float64) string {
-			return fmt.Sprintf("%.00f", f) + "%"
-		},
-	}
-	p, err := charts.Render(chartOption)
-
+// NotifySubscribers sends the rates notification to every chat that has not
+// been notified of the latest announced issue. Deliveries are recorded in the
+// outbox so a broadcast interrupted by a restart resumes without notifying a
+// chat twice. The notification is rendered before any chat is sent it, so
+// only Telegram errors count as failed attempts of a chat. A chat that cannot
+// be notified is logged and skipped, and is tried again on the next call.
+func (s *Scheduler) NotifySubscribers(ctx context.Context) error {
+	var notification *Notification
+	err := Retry(ctx, DefaultRetryPolicy, "render notification", func() (err error) {
+		notification, err = s.Notifier.Notification(ctx)
+		return err
+	})
 	if err != nil {
-		return nil, err
+		return err
+	}
+	issueCode := notification.IssueCode
+	var chats []schemas.ChatSettings
+	err = Retry(ctx, DefaultRetryPolicy, "get users to notify", func() (err error) {
+		chats, err = s.Repository.GetUsersToNotify(ctx, issueCode)
+		return err
+	})
+	if err != nil || len(chats) == 0 {
+		return err
 	}
 
-	buf, err := p.Bytes()
+	chatIds := make([]int64, len(chats))
+	for i, chat := range chats {
+		chatIds[i] = chat.ChatId
+	}
+	var entries []schemas.OutboxEntry
+	err = Retry(ctx, DefaultRetryPolicy, "enqueue notifications", func() (err error) {
+		if err := s.Repository.EnqueueNotifications(ctx, issueCode, chatIds, time.Now().In(s.Timezone)); err != nil {
+			return err
+		}
+		entries, err = s.Repository.GetNotifications(ctx, issueCode)
+		return err
+	})
 	if err != nil {
-		return nil, err
+		return err
+	}
+	entriesByChatId := make(map[int64]schemas.OutboxEntry, len(entries))
+	for _, entry := range entries {
+		entriesByChatId[entry.ChatId] = entry
+	}
+	for _, entry := range s.takeUnsavedNotifications(issueCode) {
+		// an in flight entry whose send is known to have finished must not be
+		// taken for an interrupted send that may have been delivered
+		if err := s.Repository.UpdateNotification(ctx, entry); err != nil {
+			log.Errorf("error updating outbox entry of %v: %v", entry.ChatId, err)
+			s.keepUnsavedNotification(entry)
+		}
+		entriesByChatId[entry.ChatId] = entry
 	}
-	return &buf, nil
-}
 
-func GenerateNotificationMessage(chatID int64, timezone *time.Location) (*tgbotapi.PhotoConfig, error) {
-	// get the last 12 bonds
-	bondsPtr, err := ListBonds(time.Now().In(timezone).AddDate(-1, 0, 0), time.Now().In(timezone).AddDate(0, 1, 0), 12)
-	if err != nil {
-		return nil, err
+	var chatIdsToNotify []int64
+	for _, chat := range chats {
+		entry := entriesByChatId[chat.ChatId]
+		switch {
+		case entry.Status == schemas.OutboxStatusSent:
+			// notified before an interruption, only the chat settings update was lost
+			if err := s.markChatNotified(ctx, chat.ChatId, issueCode); err != nil {
+				log.Errorf("error updating chat settings of %v: %v", chat.ChatId, err)
+			}
+		case entry.Status == schemas.OutboxStatusFailed && entry.Attempts >= maxNotificationAttempts:
+			continue
+		case entry.Status == schemas.OutboxStatusInFlight && s.since(entry.UpdatedTime) < inFlightTimeout:
+			// still being sent by an earlier run
+			continue
+		case entry.Status == schemas.OutboxStatusInFlight:
+			// the send was interrupted and may have been delivered, sending
+			// again risks notifying the chat twice
+			log.Warnf("notification of %v to chat %v was interrupted while sending, assuming it was delivered", issueCode, chat.ChatId)
+			entry.Status = schemas.OutboxStatusSent
+			entry.LastError = "interrupted while sending, assumed delivered"
+			entry.UpdatedTime = schemas.DatetimeWithoutTimezone(time.Now().In(s.Timezone))
+			if err := s.Repository.UpdateNotification(ctx, entry); err != nil {
+				log.Errorf("error updating outbox entry of %v: %v", chat.ChatId, err)
+				continue
+			}
+			if err := s.markChatNotified(ctx, chat.ChatId, issueCode); err != nil {
+				log.Errorf("error updating chat settings of %v: %v", chat.ChatId, err)
+			}
+		default:
+			chatIdsToNotify = append(chatIdsToNotify, chat.ChatId)
+		}
 	}
-	bonds := *bondsPtr
 
-	var latestBond schemas.SavingsBonds
-	var latestBondInterests schemas.BondInterest
+	log.Infof("notifying %v chats of %v", len(chatIdsToNotify), issueCode)
+	s.Broadcaster.Broadcast(ctx, chatIdsToNotify, func(chatId int64) {
+		if err := s.notifyChat(ctx, chatId, entriesByChatId[chatId], notification); err != nil {
+			log.Errorf("error notifying chat %v of %v (%v): %v", chatId, issueCode, ClassifyTelegramError(err), err)
+		}
+	})
+	return nil
+}
 
-	latestBond = bonds[0]
-	for i := len(bonds)/2 - 1; i >= 0; i-- {
-		opp := len(bonds) - 1 - i
-		bonds[i], bonds[opp] = bonds[opp], bonds[i]
+func (s *Scheduler) notifyChat(ctx context.Context, chatId int64, entry schemas.OutboxEntry, notification *Notification) error {
+	entry.Status = schemas.OutboxStatusInFlight
+	entry.UpdatedTime = schemas.DatetimeWithoutTimezone(time.Now().In(s.Timezone))
+	err := Retry(ctx, DefaultRetryPolicy, fmt.Sprintf("update outbox entry of %v", chatId), func() error {
+		return s.Repository.UpdateNotification(ctx, entry)
+	})
+	if err != nil {
+		// without the in-flight record a crash while sending could send twice
+		return err
 	}
 
-	var bondReturns []float64
-	var bondDates []string
-
-	for _, bond := range bonds {
-		bondInterestRate, err := ListBondInterestRates(bond)
-		if err != nil {
-			return nil, err
+	sendErr := Retry(ctx, DefaultRetryPolicy, fmt.Sprintf("notify chat %v", chatId), func() error {
+		message, err := s.Notifier.SendNotification(s.Sender, chatId, notification)
+		if err == nil && message.Chat != nil {
+			// the group may have been migrated to a supergroup while sending,
+			// which also migrates its outbox entries
+			chatId = message.Chat.ID
+			entry.ChatId = message.Chat.ID
 		}
-		bondReturns = append(bondReturns, bondInterestRate.Year10Return)
-		bondDates = append(bondDates, time.Time(bond.IssueDate).Format("Jan 06"))
-		if bond.IssueCode == latestBond.IssueCode {
-			latestBondInterests = *bondInterestRate
+		return err
+	})
+
+	entry.Attempts++
+	entry.UpdatedTime = schemas.DatetimeWithoutTimezone(time.Now().In(s.Timezone))
+	if sendErr != nil {
+		metrics.NotificationsFailed.WithLabelValues(ClassifyTelegramError(sendErr).String()).Inc()
+		entry.Status = schemas.OutboxStatusFailed
+		entry.LastError = sendErr.Error()
+		if IsPermanent(sendErr) {
+			entry.Attempts = max(entry.Attempts, maxNotificationAttempts)
 		}
+	} else {
+		metrics.NotificationsSent.Inc()
+		entry.Status = schemas.OutboxStatusSent
+		entry.LastError = ""
 	}
-	buf, err := GenerateSSBInterestRatesChart(bondReturns, bondDates)
+	err = Retry(ctx, DefaultRetryPolicy, fmt.Sprintf("update outbox entry of %v", chatId), func() error {
+		return s.Repository.UpdateNotification(ctx, entry)
+	})
 	if err != nil {
-		return nil, err
+		s.keepUnsavedNotification(entry)
 	}
-	photoFileBytes := tgbotapi.FileBytes{
-		Name:  "picture",
-		Bytes: *buf,
+	if sendErr != nil {
+		return sendErr
 	}
-	photoConfig := tgbotapi.NewPhoto(chatID, photoFileBytes)
-
-	// add message information on the latest bond
-	photoConfig.Caption = FormatSavingsBondNotification(latestBond, latestBondInterests)
-	photoConfig.ParseMode = "MarkdownV2"
-	return &photoConfig, nil
+	if err != nil {
+		return err
+	}
+	return s.markChatNotified(ctx, chatId, entry.IssueCode)
 }
 
-func ScheduleUpdate(bot *tgbotapi.BotAPI) {
-	localTimezone, err := time.LoadLocation("Asia/Singapore") // Look up a location by it's IANA name.
-	if err != nil {
-		panic(err)
+// keepUnsavedNotification keeps the outcome of a send the outbox could not be
+// updated with, for the next broadcast to save.
+func (s *Scheduler) keepUnsavedNotification(entry schemas.OutboxEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.unsavedNotifications == nil {
+		s.unsavedNotifications = make(map[int64]schemas.OutboxEntry)
 	}
-	var wg sync.WaitGroup
+	s.unsavedNotifications[entry.ChatId] = entry
+}
 
-	for {
-		time.Sleep(1 * time.Minute)
-		// rates for the next month will be released in the current month
-		monthToFind := int(time.Now().In(localTimezone).Month()) + 1
-		chats, err := schemas.GetUsersToNotify(monthToFind)
-		if err != nil {
-			panic(err)
+// takeUnsavedNotifications returns the unsaved outcomes of sends of issueCode
+// and forgets every unsaved outcome, those of older issues are no longer needed.
+func (s *Scheduler) takeUnsavedNotifications(issueCode string) []schemas.OutboxEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var entries []schemas.OutboxEntry
+	for _, entry := range s.unsavedNotifications {
+		if entry.IssueCode == issueCode {
+			entries = append(entries, entry)
 		}
+	}
+	s.unsavedNotifications = nil
+	return entries
+}
 
-		if len(chats) > 0 {
-			bondsPtr, err := ListBonds(time.Now().In(localTimezone).AddDate(0, -1, 0), time.Now().AddDate(0, 1, 0).In(localTimezone), 1)
-			if err != nil {
-				panic(err)
-			}
-			for _, bond := range *bondsPtr {
-				if int(time.Time(bond.IssueDate).Month()) < monthToFind {
-					// this month's bonds not released yet, skipping loop
-					continue
-				}
-			}
+func (s *Scheduler) markChatNotified(ctx context.Context, chatId int64, issueCode string) error {
+	return s.updateChatSettings(ctx, chatId, func(chatSettings *schemas.ChatSettings) {
+		chatSettings.LastNotificationTime = schemas.DatetimeWithoutTimezone(time.Now().In(s.Timezone))
+		chatSettings.LatestSSBIssueNotified = issueCode
+	})
+}
+
+// updateChatSettings applies update to the current settings of a chat. The
+// settings are read again rather than taken from when the chats were listed,
+// so changes made since by commands or other jobs are kept.
+func (s *Scheduler) updateChatSettings(ctx context.Context, chatId int64, update func(chatSettings *schemas.ChatSettings)) error {
+	return Retry(ctx, DefaultRetryPolicy, fmt.Sprintf("update chat settings of %v", chatId), func() error {
+		chatSettings, err := s.Repository.GetChatSettings(ctx, chatId)
+		if err != nil || chatSettings == nil {
+			return err
 		}
+		update(chatSettings)
+		return s.Repository.UpdateChatSettings(ctx, *chatSettings)
+	})
+}
 
-		for _, chat := range chats {
-			wg.Add(1)
-			go func(bot *tgbotapi.BotAPI, chatSettings *schemas.ChatSettings, timezone *time.Location) {
-				defer wg.Done()
-				photoConfig, err := GenerateNotificationMessage(chatSettings.ChatId, timezone)
-				if err != nil {
-					panic(err)
-				}
-				if _, err := bot.Send(photoConfig); err != nil {
-					panic(err)
-				}
-				chatSettings.LastNotificationTime = schemas.DatetimeWithoutTimezone(time.Now().In(localTimezone))
-				chatSettings.LatestSSBMonthNotified = monthToFind
-				chatSettings.Update()
-			}(bot, &chat, localTimezone)
-			wg.Wait()
+// sendMessageToChat sends a MarkdownV2 message to a chat, then records it in
+// the chat's settings with markSent.
+func (s *Scheduler) sendMessageToChat(ctx context.Context, chatId int64, text string, markSent func(chatSettings *schemas.ChatSettings)) error {
+	err := Retry(ctx, DefaultRetryPolicy, fmt.Sprintf("send message to chat %v", chatId), func() error {
+		msg := tgbotapi.NewMessage(chatId, text)
+		msg.ParseMode = "MarkdownV2"
+		message, err := s.Sender.Send(msg)
+		if err == nil && message.Chat != nil {
+			// the group may have been migrated to a supergroup while sending
+			chatId = message.Chat.ID
 		}
+		return err
+	})
+	if err != nil {
+		return err
 	}
+	return s.updateChatSettings(ctx, chatId, markSent)
 }
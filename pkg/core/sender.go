@@ -0,0 +1,242 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/repository"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+// Sender is the subset of tgbotapi.BotAPI used to talk to chats, so that a
+// fake can stand in for telegram in tests.
+type Sender interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error)
+}
+
+var _ Sender = (*tgbotapi.BotAPI)(nil)
+
+// sendMediaGroupMessages sends a media group with sender. tgbotapi.BotAPI.Send
+// cannot decode the messages telegram returns for a media group, so it is
+// sent with Request instead.
+func sendMediaGroupMessages(sender Sender, config tgbotapi.MediaGroupConfig) ([]tgbotapi.Message, error) {
+	resp, err := sender.Request(config)
+	if err != nil {
+		return nil, err
+	}
+	var messages []tgbotapi.Message
+	if err := json.Unmarshal(resp.Result, &messages); err != nil {
+		return nil, fmt.Errorf("error decoding media group messages: %w", err)
+	}
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("telegram returned no messages for the media group")
+	}
+	return messages, nil
+}
+
+// sendMediaGroup sends a media group with sender and returns its first message.
+func sendMediaGroup(sender Sender, config tgbotapi.MediaGroupConfig) (tgbotapi.Message, error) {
+	messages, err := sendMediaGroupMessages(sender, config)
+	if err != nil {
+		return tgbotapi.Message{}, err
+	}
+	return messages[0], nil
+}
+
+type TelegramErrorKind int
+
+const (
+	TelegramErrorNone TelegramErrorKind = iota
+	// network errors and telegram server errors, worth retrying
+	TelegramErrorTransient
+	// 429 flood control, retry after the returned retry_after
+	TelegramErrorRateLimited
+	// 403 the user blocked the bot, or the bot was kicked from the group
+	TelegramErrorBotBlocked
+	// 400 the chat does not exist anymore
+	TelegramErrorChatNotFound
+	// 400 the group was upgraded to a supergroup with a new chat id
+	TelegramErrorChatMigrated
+	// any other 4xx, the request itself is invalid
+	TelegramErrorBadRequest
+)
+
+func (k TelegramErrorKind) String() string {
+	switch k {
+	case TelegramErrorNone:
+		return "none"
+	case TelegramErrorTransient:
+		return "transient"
+	case TelegramErrorRateLimited:
+		return "rate limited"
+	case TelegramErrorBotBlocked:
+		return "bot blocked"
+	case TelegramErrorChatNotFound:
+		return "chat not found"
+	case TelegramErrorChatMigrated:
+		return "chat migrated"
+	default:
+		return "bad request"
+	}
+}
+
+// IsPermanent reports whether sending to the same chat again cannot succeed.
+func (k TelegramErrorKind) IsPermanent() bool {
+	switch k {
+	case TelegramErrorBotBlocked, TelegramErrorChatNotFound, TelegramErrorChatMigrated, TelegramErrorBadRequest:
+		return true
+	default:
+		return false
+	}
+}
+
+// ClassifyTelegramError sorts an error returned by the telegram bot api. Errors
+// that did not come from telegram are transient.
+func ClassifyTelegramError(err error) TelegramErrorKind {
+	if err == nil {
+		return TelegramErrorNone
+	}
+	var tgErr *tgbotapi.Error
+	if !errors.As(err, &tgErr) {
+		return TelegramErrorTransient
+	}
+	message := strings.ToLower(tgErr.Message)
+	switch {
+	case tgErr.MigrateToChatID != 0:
+		return TelegramErrorChatMigrated
+	case tgErr.Code == 429:
+		return TelegramErrorRateLimited
+	case tgErr.Code == 403:
+		return TelegramErrorBotBlocked
+	case tgErr.Code == 400 && (strings.Contains(message, "chat not found") || strings.Contains(message, "group chat was deleted")):
+		return TelegramErrorChatNotFound
+	case tgErr.Code >= 400 && tgErr.Code < 500:
+		return TelegramErrorBadRequest
+	default:
+		return TelegramErrorTransient
+	}
+}
+
+// TelegramRetryAfter returns how long telegram asked to wait before retrying, if at all.
+func TelegramRetryAfter(err error) time.Duration {
+	var tgErr *tgbotapi.Error
+	if errors.As(err, &tgErr) && tgErr.RetryAfter > 0 {
+		return time.Duration(tgErr.RetryAfter) * time.Second
+	}
+	return 0
+}
+
+// ChatIDOf returns the chat a Chattable is addressed to, if it is one of the
+// configs the bot sends.
+func ChatIDOf(c tgbotapi.Chattable) (int64, bool) {
+	switch c := c.(type) {
+	case tgbotapi.MessageConfig:
+		return c.ChatID, true
+	case tgbotapi.PhotoConfig:
+		return c.ChatID, true
+	case tgbotapi.MediaGroupConfig:
+		return c.ChatID, true
+	default:
+		return 0, false
+	}
+}
+
+// withChatID returns a copy of c addressed to chatID instead.
+func withChatID(c tgbotapi.Chattable, chatID int64) (tgbotapi.Chattable, bool) {
+	switch c := c.(type) {
+	case tgbotapi.MessageConfig:
+		c.ChatID = chatID
+		return c, true
+	case tgbotapi.PhotoConfig:
+		c.ChatID = chatID
+		return c, true
+	case tgbotapi.MediaGroupConfig:
+		c.ChatID = chatID
+		return c, true
+	default:
+		return c, false
+	}
+}
+
+// subscriptionUpdateTimeout bounds the repository writes of SubscriptionSender.
+// Sender has no context, and the writes should finish even while shutting down.
+const subscriptionUpdateTimeout = 30 * time.Second
+
+// SubscriptionSender wraps a Sender and keeps ChatSettings in sync with what
+// telegram reports about a chat. Chats that blocked the bot or no longer exist
+// are marked unsubscribed, so they are not notified again. Sends to a group
+// that was upgraded to a supergroup migrate its settings and are retried on
+// the supergroup.
+type SubscriptionSender struct {
+	sender           Sender
+	chatSettingsRepo repository.ChatSettingsRepository
+}
+
+func NewSubscriptionSender(sender Sender, chatSettingsRepo repository.ChatSettingsRepository) *SubscriptionSender {
+	return &SubscriptionSender{
+		sender:           sender,
+		chatSettingsRepo: chatSettingsRepo,
+	}
+}
+
+func (s *SubscriptionSender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	message, err := s.sender.Send(c)
+	if migrated, ok := s.migrate(c, err); ok {
+		return s.sender.Send(migrated)
+	}
+	s.handleError(c, err)
+	return message, err
+}
+
+func (s *SubscriptionSender) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	resp, err := s.sender.Request(c)
+	if migrated, ok := s.migrate(c, err); ok {
+		return s.sender.Request(migrated)
+	}
+	s.handleError(c, err)
+	return resp, err
+}
+
+// migrate moves the chat's settings if err says the chat was migrated, and
+// returns c addressed to the new chat id.
+func (s *SubscriptionSender) migrate(c tgbotapi.Chattable, err error) (tgbotapi.Chattable, bool) {
+	var tgErr *tgbotapi.Error
+	if !errors.As(err, &tgErr) || tgErr.MigrateToChatID == 0 {
+		return nil, false
+	}
+	chatID, ok := ChatIDOf(c)
+	if !ok {
+		return nil, false
+	}
+	log.Infof("chat %v migrated to %v", chatID, tgErr.MigrateToChatID)
+	ctx, cancel := context.WithTimeout(context.Background(), subscriptionUpdateTimeout)
+	defer cancel()
+	if err := s.chatSettingsRepo.MigrateChatSettings(ctx, chatID, tgErr.MigrateToChatID); err != nil {
+		log.Errorf("error migrating chat settings from %v to %v: %v", chatID, tgErr.MigrateToChatID, err)
+	}
+	return withChatID(c, tgErr.MigrateToChatID)
+}
+
+func (s *SubscriptionSender) handleError(c tgbotapi.Chattable, err error) {
+	kind := ClassifyTelegramError(err)
+	if kind != TelegramErrorBotBlocked && kind != TelegramErrorChatNotFound {
+		return
+	}
+	chatID, ok := ChatIDOf(c)
+	if !ok {
+		return
+	}
+	reason := fmt.Sprintf("%v: %v", kind, err)
+	log.Infof("unsubscribing chat %v, %v", chatID, reason)
+	ctx, cancel := context.WithTimeout(context.Background(), subscriptionUpdateTimeout)
+	defer cancel()
+	if err := repository.MarkChatUnsubscribed(ctx, s.chatSettingsRepo, chatID, reason); err != nil {
+		log.Errorf("error unsubscribing chat %v: %v", chatID, err)
+	}
+}
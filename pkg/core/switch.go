@@ -0,0 +1,111 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+)
+
+// SwitchComparison compares keeping a holding to maturity against redeeming it
+// and reinvesting in the next issue, over the remaining term of the holding.
+type SwitchComparison struct {
+	IssueCode       string // the held issue
+	LatestIssueCode string // the issue whose rates the next issue is assumed to pay
+	Amount          int
+	RequestDeadline time.Time // last day to request the redemption
+	RedemptionDate  time.Time // the held issue stops earning interest
+	CashDate        time.Time // the redeemed cash arrives by this date
+	NewIssueDate    time.Time // the cash is reinvested on this date
+	MaturityDate    time.Time // of the held issue, the end of the comparison
+	YearsRemaining  float64
+	KeepInterest    float64 // interest from the redemption date to maturity if kept
+	SwitchInterest  float64 // interest from the redemption date to maturity if switched
+	KeepReturn      float64 // in percent per year
+	SwitchReturn    float64 // in percent per year
+}
+
+// ShouldSwitch reports whether switching earns more interest than keeping.
+func (c SwitchComparison) ShouldSwitch() bool {
+	return c.SwitchInterest > c.KeepInterest
+}
+
+// CompareSwitch compares keeping amount dollars of bond to maturity against
+// redeeming it with the first request that can still be made from now, and
+// reinvesting the cash in the first issue that can be applied for once it
+// arrives. That issue is assumed to pay the rates of latestInterest. The cash
+// earns nothing between the redemption and the new issue date.
+func CompareSwitch(bond schemas.SavingsBonds, interest schemas.BondInterest, latestInterest schemas.BondInterest, amount int, now time.Time) (*SwitchComparison, error) {
+	requestMonth := monthOf(now)
+	if today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC); today.After(nthLastBusinessDay(requestMonth, redemptionRequestBusinessDaysBeforeMonthEnd)) {
+		requestMonth = requestMonth.AddDate(0, 1, 0)
+	}
+	if start := time.Time(bond.StartOfRedemption); !start.IsZero() && requestMonth.Before(monthOf(start)) {
+		requestMonth = monthOf(start)
+	}
+	redemption, err := CalculateRedemption(bond, interest, amount, requestMonth)
+	if err != nil {
+		return nil, err
+	}
+	maturityDate := time.Time(bond.MaturityDate)
+	if !redemption.RedemptionDate.Before(maturityDate) {
+		return nil, fmt.Errorf("%v matures before it can be redeemed", bond.IssueCode)
+	}
+
+	// the cash arrives early in the month of the redemption, in time to apply
+	// for the issue of the following month
+	newIssueDate := redemption.RedemptionDate.AddDate(0, 1, 0)
+	comparison := &SwitchComparison{
+		IssueCode:       bond.IssueCode,
+		LatestIssueCode: latestInterest.IssueCode,
+		Amount:          amount,
+		RequestDeadline: redemption.RequestDeadline,
+		RedemptionDate:  redemption.RedemptionDate,
+		CashDate:        redemption.PaymentDate,
+		NewIssueDate:    newIssueDate,
+		MaturityDate:    maturityDate,
+		YearsRemaining:  float64(monthsBetween(redemption.RedemptionDate, maturityDate)) / 12,
+	}
+	// the interest accrued up to the redemption is earned either way
+	comparison.KeepInterest = ProjectedInterest(amount, interest) - redemption.CouponsReceived - redemption.AccruedInterest
+
+	if newIssueDate.Before(maturityDate) {
+		newBond := schemas.SavingsBonds{
+			IssueCode:         latestInterest.IssueCode,
+			IssueDate:         schemas.BondDate(newIssueDate),
+			FirstInterestDate: schemas.BondDate(newIssueDate.AddDate(0, 6, 0)),
+		}
+		// held until the old issue would have matured, on the first of a month
+		newRedemption, err := CalculateRedemption(newBond, latestInterest, amount, maturityDate.AddDate(0, -1, 0))
+		if err != nil {
+			return nil, err
+		}
+		comparison.SwitchInterest = newRedemption.CouponsReceived + newRedemption.AccruedInterest
+	}
+
+	if comparison.YearsRemaining > 0 {
+		comparison.KeepReturn = comparison.KeepInterest / float64(amount) / comparison.YearsRemaining * 100
+		comparison.SwitchReturn = comparison.SwitchInterest / float64(amount) / comparison.YearsRemaining * 100
+	}
+	return comparison, nil
+}
+
+// FormatSwitchComparison returns the MarkdownV2 summary of a comparison.
+func FormatSwitchComparison(c SwitchComparison) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "🔄 *Switching %s of %s* 🔄\n\n", FormatDollars(float64(c.Amount)), c.IssueCode)
+	fmt.Fprintf(&b, "*Redeem:* request by %s, redeemed on %s\n", c.RequestDeadline.Format("02 Jan 2006"), c.RedemptionDate.Format("02 Jan 2006"))
+	fmt.Fprintf(&b, "*Reinvest:* cash arrives by %s, next issue on %s\n\n", c.CashDate.Format("02 Jan 2006"), c.NewIssueDate.Format("02 Jan 2006"))
+	fmt.Fprintf(&b, "*Until %s matures on %s:*\n", c.IssueCode, c.MaturityDate.Format("02 Jan 2006"))
+	fmt.Fprintf(&b, "\\- Keep: %s interest, %.2f%% a year\n", FormatDollars(c.KeepInterest), c.KeepReturn)
+	fmt.Fprintf(&b, "\\- Switch: %s interest, %.2f%% a year\n\n", FormatDollars(c.SwitchInterest), c.SwitchReturn)
+	difference := c.SwitchInterest - c.KeepInterest
+	if c.ShouldSwitch() {
+		fmt.Fprintf(&b, "*Recommendation:* switch, it earns %s more\n", FormatDollars(difference))
+	} else {
+		fmt.Fprintf(&b, "*Recommendation:* keep %s, switching earns %s less\n", c.IssueCode, FormatDollars(-difference))
+	}
+	fmt.Fprintf(&b, "\n_Assumes the next issue pays the same rates as %s, and the cash earns nothing until it is issued._\n", c.LatestIssueCode)
+	return strings.Replace(b.String(), ".", "\\.", -1)
+}
@@ -0,0 +1,53 @@
+package core_test
+
+import (
+	"testing"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/core"
+)
+
+func TestCompareSwitch(t *testing.T) {
+	bond, interest := testBond("SBMAR23", date(2023, 3, 1))
+	// the next issue pays what the held one paid in its first years, less
+	// than the held one pays in its last five
+	_, sameRates := testBond("SBAPR28", date(2028, 4, 1))
+	comparison, err := core.CompareSwitch(bond, interest, sameRates, 10000, date(2028, 2, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := comparison.RedemptionDate, date(2028, 3, 1); !got.Equal(want) {
+		t.Errorf("redeemed on %v, want %v", got, want)
+	}
+	if got, want := comparison.NewIssueDate, date(2028, 4, 1); !got.Equal(want) {
+		t.Errorf("reinvested on %v, want %v", got, want)
+	}
+	if comparison.YearsRemaining != 5 {
+		t.Errorf("%v years remaining, want 5", comparison.YearsRemaining)
+	}
+	if comparison.ShouldSwitch() {
+		t.Errorf("switching to lower rates earns %v against %v kept", comparison.SwitchInterest, comparison.KeepInterest)
+	}
+
+	higherRates := sameRates
+	higherRates.Year1Coupon, higherRates.Year2Coupon, higherRates.Year3Coupon = 5, 5, 5
+	higherRates.Year4Coupon, higherRates.Year5Coupon = 5, 5
+	comparison, err = core.CompareSwitch(bond, interest, higherRates, 10000, date(2028, 2, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !comparison.ShouldSwitch() {
+		t.Errorf("switching to higher rates earns %v against %v kept", comparison.SwitchInterest, comparison.KeepInterest)
+	}
+}
+
+func TestCompareSwitchAfterRequestDeadline(t *testing.T) {
+	bond, interest := testBond("SBMAR23", date(2023, 3, 1))
+	// past the deadline of Feb 2028, so redeemed with a request in March
+	comparison, err := core.CompareSwitch(bond, interest, interest, 10000, date(2028, 2, 28))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := comparison.RedemptionDate, date(2028, 4, 1); !got.Equal(want) {
+		t.Errorf("redeemed on %v, want %v", got, want)
+	}
+}
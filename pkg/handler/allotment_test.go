@@ -0,0 +1,71 @@
+package handler_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+)
+
+// tenderedDaysAgo moves the tender date of this month's issue, the latest
+// with allotment results, to days before today.
+func tenderedDaysAgo(t *testing.T, bot *testBot, days int) string {
+	t.Helper()
+	var issueCode string
+	bot.updateBond(t, 0, func(bond *schemas.SavingsBonds) {
+		bond.TenderDate = daysFromToday(bot.timezone, -days)
+		issueCode = bond.IssueCode
+	})
+	return issueCode
+}
+
+func TestNotifyAllotmentOncePerIssue(t *testing.T) {
+	ctx := context.Background()
+	bot := newTestBot(t)
+	bot.handle(1, "/subscribe")
+	bot.handle(2, "/subscribe")
+	issueCode := tenderedDaysAgo(t, bot, 3)
+
+	if err := bot.scheduler.NotifyAllotment(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, chatId := range []int64{1, 2} {
+		if sent := len(bot.sender.SentTo(chatId)); sent != 2 {
+			t.Fatalf("sent %v messages to chat %v, want the subscribe reply and the results", sent, chatId)
+		}
+		if reply := lastReply(t, bot, chatId); !strings.Contains(reply, "Allotment Results \\("+issueCode+"\\)") {
+			t.Errorf("sent %q to chat %v, want the allotment results of %v", reply, chatId, issueCode)
+		}
+		chatSettings, err := bot.repo.GetChatSettings(ctx, chatId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chatSettings.LatestSSBAllotmentNotified != issueCode {
+			t.Errorf("chat %v was sent the results of %q, want %q", chatId, chatSettings.LatestSSBAllotmentNotified, issueCode)
+		}
+	}
+
+	// the next run finds every chat sent the results
+	sentBefore := len(bot.sender.Sent())
+	if err := bot.scheduler.NotifyAllotment(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sent := len(bot.sender.Sent()); sent != sentBefore {
+		t.Errorf("sent %v more messages on the second run, want none", sent-sentBefore)
+	}
+}
+
+func TestNotifyAllotmentNotAfterResultsWindow(t *testing.T) {
+	ctx := context.Background()
+	bot := newTestBot(t)
+	bot.handle(1, "/subscribe")
+	tenderedDaysAgo(t, bot, 15)
+
+	if err := bot.scheduler.NotifyAllotment(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sent := len(bot.sender.SentTo(1)); sent != 1 {
+		t.Errorf("sent %v messages to chat 1, want only the subscribe reply", sent)
+	}
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/core"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/repository"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// HandleCalendar lists the coupon payments of the chat's holdings in the next
+// 12 months, or with "/calendar notify on|off" sets whether the chat is
+// notified on the days they are paid. The reply is formatted as MarkdownV2.
+func HandleCalendar(ctx context.Context, update *tgbotapi.Update, repo repository.Repository, masClient core.MASClient, localTimezone *time.Location) (string, error) {
+	chatId := update.Message.Chat.ID
+	args := strings.Fields(update.Message.CommandArguments())
+	switch {
+	case len(args) == 0:
+		holdings, err := repo.GetHoldings(ctx, chatId)
+		if err != nil {
+			return "", err
+		}
+		if len(holdings) == 0 {
+			return escape("You have no holdings. Use /hold add <issue code> <amount> to add one."), nil
+		}
+		now := time.Now().In(localTimezone)
+		payments, err := core.HoldingsCalendar(ctx, masClient, localTimezone, holdings, now, now.AddDate(1, 0, 0))
+		if err != nil {
+			return "", err
+		}
+		return core.FormatCalendar(payments), nil
+	case len(args) == 2 && args[0] == "notify" && (args[1] == "on" || args[1] == "off"):
+		chatSettings, err := repo.GetChatSettings(ctx, chatId)
+		if err != nil {
+			return "", err
+		}
+		if chatSettings == nil {
+			return escape("Payout notifications are only sent to subscribed chats, /subscribe first."), nil
+		}
+		chatSettings.PayoutNotifications = args[1] == "on"
+		if err := repo.UpdateChatSettings(ctx, *chatSettings); err != nil {
+			return "", err
+		}
+		if chatSettings.PayoutNotifications {
+			return escape("You will be notified on the days your holdings pay coupons."), nil
+		}
+		return escape("You will no longer be notified of coupon payments."), nil
+	default:
+		return escape("Usage: /calendar or /calendar notify on|off"), nil
+	}
+}
@@ -0,0 +1,45 @@
+package handler_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/core"
+)
+
+func TestNotifyPayoutsMarksChatsWithoutPaymentsChecked(t *testing.T) {
+	ctx := context.Background()
+	bot := newTestBot(t)
+	latestBond, err := core.LatestIssue(ctx, bot.masClient, bot.timezone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot.handle(1, "/subscribe")
+	bot.handle(1, "/calendar notify on")
+	// the latest issue pays its first coupon months from now
+	bot.handle(1, "/hold add "+latestBond.IssueCode+" 5000")
+	sentBefore := len(bot.sender.Sent())
+
+	if err := bot.scheduler.NotifyPayouts(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sent := len(bot.sender.Sent()); sent != sentBefore {
+		t.Errorf("sent %v messages without payments due, want none", sent-sentBefore)
+	}
+	today := time.Now().In(bot.timezone).Format(time.DateOnly)
+	chatSettings, err := bot.repo.GetChatSettings(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chatSettings.LastPayoutNotified != today {
+		t.Errorf("last checked for payouts on %q, want %v", chatSettings.LastPayoutNotified, today)
+	}
+	chats, err := bot.repo.GetUsersToNotifyPayouts(ctx, today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chats) != 0 {
+		t.Errorf("%v chats still to check for payouts today, want none", len(chats))
+	}
+}
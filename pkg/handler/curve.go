@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/core"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// HandleCurve charts the coupon and average return of each year of an issue
+// against the issue before it, e.g. "/curve SBJAN25", or of the latest issue
+// if none is given. It returns the photo to send, or a message if the issue
+// cannot be charted.
+func HandleCurve(ctx context.Context, update *tgbotapi.Update, masClient core.MASClient, localTimezone *time.Location) (tgbotapi.Chattable, error) {
+	chatId := update.Message.Chat.ID
+	args := strings.Fields(update.Message.CommandArguments())
+	if len(args) > 1 {
+		return tgbotapi.NewMessage(chatId, "Usage: /curve [issue code], e.g. /curve SBJAN25"), nil
+	}
+
+	var bond *schemas.SavingsBonds
+	if len(args) == 0 {
+		latestBond, err := core.LatestIssue(ctx, masClient, localTimezone)
+		if err != nil {
+			return nil, err
+		}
+		bond = latestBond
+	} else {
+		issueCode := strings.ToUpper(args[0])
+		bonds, err := core.ListHeldBonds(ctx, masClient, localTimezone, []string{issueCode})
+		if err != nil {
+			return nil, err
+		}
+		heldBond, ok := bonds[issueCode]
+		if !ok {
+			return tgbotapi.NewMessage(chatId, fmt.Sprintf("%v is not a savings bonds issue.", issueCode)), nil
+		}
+		bond = &heldBond
+	}
+
+	chart, err := core.RenderCouponCurve(ctx, masClient, *bond)
+	if err != nil {
+		return nil, err
+	}
+	photoConfig := tgbotapi.NewPhoto(chatId, tgbotapi.FileBytes{
+		Name:  "curve",
+		Bytes: chart,
+	})
+	photoConfig.Caption = fmt.Sprintf("Coupons and average returns of %v by year", bond.IssueCode)
+	return photoConfig, nil
+}
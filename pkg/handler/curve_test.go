@@ -0,0 +1,67 @@
+package handler_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/core"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestNotifyAttachesCurveUploadedOnce(t *testing.T) {
+	ctx := context.Background()
+	bot := newTestBotAttachingCurve(t, true)
+	for _, chatId := range []int64{1, 2, 3} {
+		bot.handle(chatId, "/subscribe")
+	}
+
+	if err := bot.scheduler.NotifySubscribers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	bot.handle(4, "/rates")
+	// the chart and the curve are uploaded with the first chat's media group,
+	// and every later chat is sent their file_ids
+	if uploads := bot.sender.Uploads(); uploads != 2 {
+		t.Errorf("uploaded %v photos, want the chart and the curve once", uploads)
+	}
+	for _, chatId := range []int64{1, 2, 3, 4} {
+		sent := bot.sender.SentTo(chatId)
+		if len(sent) == 0 {
+			t.Fatalf("nothing was sent to chat %v", chatId)
+		}
+		mediaGroup, ok := sent[len(sent)-1].Chattable.(tgbotapi.MediaGroupConfig)
+		if !ok {
+			t.Fatalf("notified chat %v with %T, want a media group", chatId, sent[len(sent)-1].Chattable)
+		}
+		if len(mediaGroup.Media) != 2 {
+			t.Errorf("chat %v was sent %v photos, want the chart and the curve", chatId, len(mediaGroup.Media))
+		}
+	}
+}
+
+func TestCurve(t *testing.T) {
+	ctx := context.Background()
+	bot := newTestBot(t)
+	latestBond, err := core.LatestIssue(ctx, bot.masClient, bot.timezone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range []string{"", " " + strings.ToLower(latestBond.IssueCode)} {
+		bot.handle(1, "/curve"+args)
+		sent := bot.sender.SentTo(1)
+		photo, ok := sent[len(sent)-1].Chattable.(tgbotapi.PhotoConfig)
+		if !ok {
+			t.Fatalf("/curve%v replied with %T, want a photo", args, sent[len(sent)-1].Chattable)
+		}
+		if !strings.Contains(photo.Caption, latestBond.IssueCode) {
+			t.Errorf("/curve%v is captioned %q, want the curve of %v", args, photo.Caption, latestBond.IssueCode)
+		}
+	}
+
+	bot.handle(1, "/curve SBXXX")
+	if reply := lastReply(t, bot, 1); !strings.Contains(reply, "not a savings bonds issue") {
+		t.Errorf("/curve of an unknown issue replied %q", reply)
+	}
+}
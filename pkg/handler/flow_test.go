@@ -0,0 +1,233 @@
+package handler_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/core"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/handler"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/masstub"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/repository"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/telegramtest"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/utils"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// commandUpdate returns an update of an allowed user sending text to chatId.
+func commandUpdate(chatId int64, text string) *tgbotapi.Update {
+	commandLength := len(text)
+	for i, c := range text {
+		if c == ' ' {
+			commandLength = i
+			break
+		}
+	}
+	return &tgbotapi.Update{Message: &tgbotapi.Message{
+		Text:     text,
+		Chat:     &tgbotapi.Chat{ID: chatId},
+		From:     &tgbotapi.User{UserName: "tester"},
+		Entities: []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: commandLength}},
+	}}
+}
+
+type testBot struct {
+	mas       *masstub.Server
+	masClient core.MASClient
+	repo      *repository.MemoryRepository
+	sender    *telegramtest.RecordingSender
+	notifier  *core.Notifier
+	scheduler *core.Scheduler
+	timezone  *time.Location
+}
+
+// newTestBot wires the handler and scheduler to an in-memory repository, a
+// recording sender and a MAS stub whose latest issue is next month's.
+func newTestBot(t *testing.T) *testBot {
+	t.Helper()
+	return newTestBotAttachingCurve(t, false)
+}
+
+// newTestBotAttachingCurve is newTestBot with the coupon curve attached to the
+// notification if attachCurve is set.
+func newTestBotAttachingCurve(t *testing.T, attachCurve bool) *testBot {
+	t.Helper()
+	utils.WhitelistedUsernames = []string{"tester"}
+	timezone, err := time.LoadLocation(utils.DEFAULT_TIMEZONE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mas := masstub.NewServer(masstub.DefaultFixtures().ShiftTo(time.Now().In(timezone).AddDate(0, 1, 0)))
+	srv := httptest.NewServer(mas)
+	t.Cleanup(srv.Close)
+
+	masClient := core.NewMASClient(core.MASClientConfig{BaseURL: srv.URL})
+	repo := repository.NewMemoryRepository()
+	sender := telegramtest.NewRecordingSender()
+	notifier := core.NewNotifier(masClient, timezone, attachCurve)
+	return &testBot{
+		mas:       mas,
+		masClient: masClient,
+		repo:      repo,
+		sender:    sender,
+		notifier:  notifier,
+		timezone:  timezone,
+		scheduler: &core.Scheduler{
+			Sender:      core.NewSubscriptionSender(sender, repo),
+			Repository:  repo,
+			MASClient:   masClient,
+			Notifier:    notifier,
+			Broadcaster: core.NewBroadcaster(4),
+			Timezone:    timezone,
+		},
+	}
+}
+
+func (b *testBot) handle(chatId int64, text string) {
+	handler.HandleUpdate(context.Background(), commandUpdate(chatId, text), b.sender, b.repo, b.masClient, b.notifier, b.timezone)
+}
+
+// updateBond changes the fixture of the issue issued monthsAhead months from
+// now, 1 being the latest issue and 0 the one issued this month.
+func (b *testBot) updateBond(t *testing.T, monthsAhead int, update func(bond *schemas.SavingsBonds)) {
+	t.Helper()
+	latestIssueDate := time.Now().In(b.timezone).AddDate(0, 1, 0)
+	fixtures := masstub.DefaultFixtures().ShiftTo(latestIssueDate)
+	issueCode := masstub.IssueCode(time.Date(latestIssueDate.Year(), latestIssueDate.Month()+time.Month(monthsAhead-1), 1, 0, 0, 0, 0, time.UTC))
+	for i := range fixtures.Bonds {
+		if fixtures.Bonds[i].IssueCode == issueCode {
+			update(&fixtures.Bonds[i])
+			b.mas.SetFixtures(fixtures)
+			return
+		}
+	}
+	t.Fatalf("no fixture of %v", issueCode)
+}
+
+// daysFromToday returns the date days from today in the timezone.
+func daysFromToday(timezone *time.Location, days int) schemas.BondDate {
+	now := time.Now().In(timezone)
+	return schemas.BondDate(time.Date(now.Year(), now.Month(), now.Day()+days, 0, 0, 0, 0, time.UTC))
+}
+
+func TestSubscribeThenNotify(t *testing.T) {
+	ctx := context.Background()
+	bot := newTestBot(t)
+	bot.handle(1, "/subscribe")
+	bot.handle(2, "/subscribe")
+
+	latestBond, err := core.LatestIssue(ctx, bot.masClient, bot.timezone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bot.scheduler.NotifySubscribers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if uploads := bot.sender.Uploads(); uploads != 1 {
+		t.Errorf("uploaded the chart %v times, want once", uploads)
+	}
+	for _, chatId := range []int64{1, 2} {
+		sent := bot.sender.SentTo(chatId)
+		if len(sent) != 2 {
+			t.Fatalf("sent %v messages to chat %v, want the subscribe reply and the notification", len(sent), chatId)
+		}
+		if _, ok := sent[1].Chattable.(tgbotapi.PhotoConfig); !ok {
+			t.Errorf("notified chat %v with %T, want a photo", chatId, sent[1].Chattable)
+		}
+		chatSettings, err := bot.repo.GetChatSettings(ctx, chatId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chatSettings.LatestSSBIssueNotified != latestBond.IssueCode {
+			t.Errorf("chat %v was notified of %q, want %q", chatId, chatSettings.LatestSSBIssueNotified, latestBond.IssueCode)
+		}
+	}
+
+	// the next run finds every chat notified
+	sentBefore := len(bot.sender.Sent())
+	if err := bot.scheduler.NotifySubscribers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sent := len(bot.sender.Sent()); sent != sentBefore {
+		t.Errorf("sent %v more messages on the second run, want none", sent-sentBefore)
+	}
+}
+
+// commandDuringSend runs a command from the chat being sent to just before
+// the send, like a command handled while a broadcast is under way.
+type commandDuringSend struct {
+	core.Sender
+	bot  *testBot
+	text string
+}
+
+func (s commandDuringSend) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	if chatId, ok := core.ChatIDOf(c); ok {
+		s.bot.handle(chatId, s.text)
+	}
+	return s.Sender.Send(c)
+}
+
+func TestNotifyKeepsSettingsChangedDuringBroadcast(t *testing.T) {
+	ctx := context.Background()
+	bot := newTestBot(t)
+	bot.handle(1, "/subscribe")
+	bot.scheduler.Sender = commandDuringSend{Sender: bot.scheduler.Sender, bot: bot, text: "/remind 3"}
+
+	if err := bot.scheduler.NotifySubscribers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	chatSettings, err := bot.repo.GetChatSettings(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chatSettings.LatestSSBIssueNotified == "" {
+		t.Error("chat was not marked notified")
+	}
+	if chatSettings.ReminderDays != 3 {
+		t.Errorf("reminder days is %v after the broadcast, want the 3 set during it", chatSettings.ReminderDays)
+	}
+}
+
+func TestNotifyUnsubscribesUnreachableChats(t *testing.T) {
+	ctx := context.Background()
+	bot := newTestBot(t)
+	for _, chatId := range []int64{1, 2, 3} {
+		bot.handle(chatId, "/subscribe")
+	}
+	bot.sender.FailChat(1, &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"})
+	bot.sender.FailChat(2, &tgbotapi.Error{Code: 400, Message: "Bad Request: chat not found"})
+
+	if err := bot.scheduler.NotifySubscribers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, chatId := range []int64{1, 2} {
+		chatSettings, err := bot.repo.GetChatSettings(ctx, chatId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chatSettings.UnsubscribedReason == "" {
+			t.Errorf("chat %v is still subscribed", chatId)
+		}
+	}
+	// chats that can no longer be reached are left out of the next issue's broadcast
+	chats, err := bot.repo.GetUsersToNotify(ctx, "SBNEXT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chats) != 1 || chats[0].ChatId != 3 {
+		t.Errorf("chats to notify of the next issue are %+v, want only chat 3", chats)
+	}
+
+	bot.sender.FailChat(1, nil)
+	bot.sender.FailChat(2, nil)
+	sentBefore := len(bot.sender.Sent())
+	if err := bot.scheduler.NotifySubscribers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sent := len(bot.sender.Sent()); sent != sentBefore {
+		t.Errorf("sent %v more messages to unsubscribed chats, want none", sent-sentBefore)
+	}
+}
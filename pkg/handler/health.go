@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+// readinessCheckTimeout bounds each dependency check of /readyz.
+const readinessCheckTimeout = 5 * time.Second
+
+// ReadinessCheck reports whether a dependency of the bot can be reached.
+type ReadinessCheck func(ctx context.Context) error
+
+// NewHealthHandler serves /healthz, which succeeds while the process is up,
+// /readyz, which succeeds while every check passes, and the prometheus
+// metrics at /metrics. The optional checks are of dependencies the bot can
+// answer commands without; /readyz reports them but does not fail on them.
+func NewHealthHandler(checks map[string]ReadinessCheck, optional map[string]ReadinessCheck) http.Handler {
+	names := make([]string, 0, len(checks)+len(optional))
+	for name := range checks {
+		names = append(names, name)
+	}
+	for name := range optional {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		var report strings.Builder
+		ready := true
+		for _, name := range names {
+			check, required := checks[name]
+			if !required {
+				check = optional[name]
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), readinessCheckTimeout)
+			err := check(ctx)
+			cancel()
+			if err != nil {
+				ready = ready && !required
+				log.Warnf("readiness check %v failed: %v", name, err)
+				fmt.Fprintf(&report, "%v: %v\n", name, err)
+			} else {
+				fmt.Fprintf(&report, "%v: ok\n", name)
+			}
+		}
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		fmt.Fprint(w, report.String())
+	})
+	mux.Handle("/metrics", promhttp.Handler())
+	return mux
+}
+
+// ListenForHealth serves the health handler on addr until ctx is done.
+func ListenForHealth(ctx context.Context, addr string, checks map[string]ReadinessCheck, optional map[string]ReadinessCheck, shutdownTimeout time.Duration) error {
+	log.Infof("serving health checks and metrics on %v", addr)
+	return listenAndServe(ctx, &http.Server{Addr: addr, Handler: NewHealthHandler(checks, optional)}, shutdownTimeout, nil)
+}
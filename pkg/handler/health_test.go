@@ -0,0 +1,36 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/handler"
+)
+
+func TestReadyzIgnoresOptionalChecks(t *testing.T) {
+	ok := func(context.Context) error { return nil }
+	down := func(context.Context) error { return errors.New("down") }
+	for _, tc := range []struct {
+		name       string
+		checks     map[string]handler.ReadinessCheck
+		optional   map[string]handler.ReadinessCheck
+		wantStatus int
+	}{
+		{"all up", map[string]handler.ReadinessCheck{"sqlite": ok}, map[string]handler.ReadinessCheck{"mas": ok}, http.StatusOK},
+		{"optional down", map[string]handler.ReadinessCheck{"sqlite": ok}, map[string]handler.ReadinessCheck{"mas": down}, http.StatusOK},
+		{"required down", map[string]handler.ReadinessCheck{"sqlite": down}, map[string]handler.ReadinessCheck{"mas": ok}, http.StatusServiceUnavailable},
+	} {
+		rec := httptest.NewRecorder()
+		handler.NewHealthHandler(tc.checks, tc.optional).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if rec.Code != tc.wantStatus {
+			t.Errorf("%v: status is %v, want %v", tc.name, rec.Code, tc.wantStatus)
+		}
+		if !strings.Contains(rec.Body.String(), "mas: ") {
+			t.Errorf("%v: the mas check is not reported in %q", tc.name, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/core"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/repository"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const holdUsage = "Usage: /hold add <issue code> <amount>, /hold remove <issue code> [amount] or /hold list"
+
+// HandleHold records the savings bonds a chat holds: "/hold add SBJAN25 5000"
+// adds to the holding of an issue, "/hold remove SBJAN25 [amount]" removes
+// some or all of it, and "/hold list" lists the holdings with their projected
+// interest. The reply is formatted as MarkdownV2.
+func HandleHold(ctx context.Context, update *tgbotapi.Update, holdingsRepo repository.HoldingsRepository, masClient core.MASClient) (string, error) {
+	chatId := update.Message.Chat.ID
+	args := strings.Fields(update.Message.CommandArguments())
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	holdings, err := holdingsRepo.GetHoldings(ctx, chatId)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		if len(holdings) == 0 {
+			return escape("You have no holdings. Use /hold add <issue code> <amount> to add one."), nil
+		}
+		issueCodes := make([]string, len(holdings))
+		for i, holding := range holdings {
+			issueCodes[i] = holding.IssueCode
+		}
+		bondInterests, err := masClient.ListBondInterests(ctx, issueCodes)
+		if err != nil {
+			return "", err
+		}
+		return core.FormatHoldings(holdings, bondInterests), nil
+	case args[0] == "add" && len(args) == 3:
+		issueCode := strings.ToUpper(args[1])
+		amount, err := strconv.Atoi(args[2])
+		if err != nil {
+			return escape(holdUsage), nil
+		}
+		// checked on its own as well as in the new total, which a negative
+		// amount would otherwise quietly reduce
+		if amount <= 0 || amount%core.HoldingAmountMultiple != 0 {
+			return escape(fmt.Sprintf("Cannot add %v of %v: amount must be a positive multiple of %v.", core.FormatDollars(float64(amount)), issueCode, core.FormatDollars(core.HoldingAmountMultiple))), nil
+		}
+		bondInterests, err := masClient.ListBondInterests(ctx, []string{issueCode})
+		if err != nil {
+			return "", err
+		}
+		if _, ok := bondInterests[issueCode]; !ok {
+			return escape(fmt.Sprintf("%v is not a savings bonds issue.", issueCode)), nil
+		}
+		newAmount := amount + holdingAmount(holdings, issueCode)
+		if err := core.ValidateHoldingAmount(holdings, issueCode, newAmount); err != nil {
+			return escape(fmt.Sprintf("Cannot add %v of %v: %v.", core.FormatDollars(float64(amount)), issueCode, err)), nil
+		}
+		if err := holdingsRepo.SaveHolding(ctx, schemas.Holding{ChatId: chatId, IssueCode: issueCode, Amount: newAmount}); err != nil {
+			return "", err
+		}
+		return escape(fmt.Sprintf("You now hold %v of %v.", core.FormatDollars(float64(newAmount)), issueCode)), nil
+	case args[0] == "remove" && (len(args) == 2 || len(args) == 3):
+		issueCode := strings.ToUpper(args[1])
+		heldAmount := holdingAmount(holdings, issueCode)
+		if heldAmount == 0 {
+			return escape(fmt.Sprintf("You do not hold %v.", issueCode)), nil
+		}
+		newAmount := 0
+		if len(args) == 3 {
+			amount, err := strconv.Atoi(args[2])
+			if err != nil || amount <= 0 {
+				return escape(holdUsage), nil
+			}
+			newAmount = max(heldAmount-amount, 0)
+		}
+		if newAmount == 0 {
+			if err := holdingsRepo.DeleteHolding(ctx, chatId, issueCode); err != nil {
+				return "", err
+			}
+			return escape(fmt.Sprintf("Removed your holding of %v.", issueCode)), nil
+		}
+		if err := core.ValidateHoldingAmount(holdings, issueCode, newAmount); err != nil {
+			return escape(fmt.Sprintf("Cannot hold %v of %v: %v.", core.FormatDollars(float64(newAmount)), issueCode, err)), nil
+		}
+		if err := holdingsRepo.SaveHolding(ctx, schemas.Holding{ChatId: chatId, IssueCode: issueCode, Amount: newAmount}); err != nil {
+			return "", err
+		}
+		return escape(fmt.Sprintf("You now hold %v of %v.", core.FormatDollars(float64(newAmount)), issueCode)), nil
+	default:
+		return escape(holdUsage), nil
+	}
+}
+
+func holdingAmount(holdings []schemas.Holding, issueCode string) int {
+	for _, holding := range holdings {
+		if holding.IssueCode == issueCode {
+			return holding.Amount
+		}
+	}
+	return 0
+}
+
+// escape escapes a plain text reply for MarkdownV2.
+func escape(text string) string {
+	return tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, text)
+}
@@ -0,0 +1,96 @@
+package handler_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/core"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// lastReply returns the text of the last message sent to chatId.
+func lastReply(t *testing.T, bot *testBot, chatId int64) string {
+	t.Helper()
+	sent := bot.sender.SentTo(chatId)
+	if len(sent) == 0 {
+		t.Fatalf("nothing was sent to chat %v", chatId)
+	}
+	message, ok := sent[len(sent)-1].Chattable.(tgbotapi.MessageConfig)
+	if !ok {
+		t.Fatalf("replied with %T, want a message", sent[len(sent)-1].Chattable)
+	}
+	return message.Text
+}
+
+func TestHoldAdd(t *testing.T) {
+	ctx := context.Background()
+	bot := newTestBot(t)
+	latestBond, err := core.LatestIssue(ctx, bot.masClient, bot.timezone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issueCode := latestBond.IssueCode
+
+	for _, tc := range []struct {
+		amount     string
+		wantAmount int
+	}{
+		{"10000", 10000},
+		{"-5000", 10000},
+		{"0", 10000},
+		{"750", 10000},
+		{"2500", 12500},
+		{"188000", 12500}, // over the limit across all holdings
+	} {
+		bot.handle(1, "/hold add "+strings.ToLower(issueCode)+" "+tc.amount)
+		holdings, err := bot.repo.GetHoldings(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		held := 0
+		for _, holding := range holdings {
+			held += holding.Amount
+		}
+		if held != tc.wantAmount {
+			t.Errorf("holding %v after adding %v, want %v (replied %q)", held, tc.amount, tc.wantAmount, lastReply(t, bot, 1))
+		}
+		if rejected := strings.HasPrefix(lastReply(t, bot, 1), "Cannot add"); rejected != (tc.amount != "10000" && tc.amount != "2500") {
+			t.Errorf("adding %v replied %q", tc.amount, lastReply(t, bot, 1))
+		}
+	}
+
+	bot.handle(1, "/hold add SBXXX 500")
+	if reply := lastReply(t, bot, 1); !strings.Contains(reply, "not a savings bonds issue") {
+		t.Errorf("adding an unknown issue replied %q", reply)
+	}
+}
+
+func TestHoldRemove(t *testing.T) {
+	ctx := context.Background()
+	bot := newTestBot(t)
+	latestBond, err := core.LatestIssue(ctx, bot.masClient, bot.timezone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issueCode := latestBond.IssueCode
+	bot.handle(1, "/hold add "+issueCode+" 5000")
+
+	bot.handle(1, "/hold remove "+issueCode+" 1000")
+	holdings, err := bot.repo.GetHoldings(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(holdings) != 1 || holdings[0].Amount != 4000 {
+		t.Fatalf("holdings are %+v after removing 1000, want 4000", holdings)
+	}
+
+	bot.handle(1, "/hold remove "+issueCode)
+	holdings, err = bot.repo.GetHoldings(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(holdings) != 0 {
+		t.Errorf("holdings are %+v after removing the issue, want none", holdings)
+	}
+}
@@ -0,0 +1,119 @@
+package handler_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/core"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/handler"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	groupChatId      = -5
+	supergroupChatId = -1005
+)
+
+// subscribeGroup subscribes the group with a holding of the latest issue, and
+// returns the issue code.
+func subscribeGroup(t *testing.T, bot *testBot) string {
+	t.Helper()
+	latestBond, err := core.LatestIssue(context.Background(), bot.masClient, bot.timezone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot.handle(groupChatId, "/subscribe")
+	bot.handle(groupChatId, "/hold add "+latestBond.IssueCode+" 5000")
+	return latestBond.IssueCode
+}
+
+// checkMigrated checks that everything kept for the group was moved to the
+// supergroup.
+func checkMigrated(t *testing.T, bot *testBot) {
+	t.Helper()
+	ctx := context.Background()
+	chatSettings, err := bot.repo.GetChatSettings(ctx, groupChatId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chatSettings != nil {
+		t.Errorf("the group still has settings %+v", chatSettings)
+	}
+	chatSettings, err = bot.repo.GetChatSettings(ctx, supergroupChatId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chatSettings == nil {
+		t.Fatal("the supergroup has no settings")
+	}
+	for chatId, want := range map[int64]int{groupChatId: 0, supergroupChatId: 1} {
+		holdings, err := bot.repo.GetHoldings(ctx, chatId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(holdings) != want {
+			t.Errorf("chat %v has %v holdings, want %v", chatId, len(holdings), want)
+		}
+	}
+}
+
+func TestSendToMigratedGroupMovesItAndRetries(t *testing.T) {
+	ctx := context.Background()
+	bot := newTestBot(t)
+	issueCode := subscribeGroup(t, bot)
+	bot.sender.FailChat(groupChatId, &tgbotapi.Error{
+		Code:               400,
+		Message:            "Bad Request: group chat was upgraded to a supergroup chat",
+		ResponseParameters: tgbotapi.ResponseParameters{MigrateToChatID: supergroupChatId},
+	})
+
+	if err := bot.scheduler.NotifySubscribers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	checkMigrated(t, bot)
+	sent := bot.sender.SentTo(supergroupChatId)
+	if len(sent) != 1 {
+		t.Fatalf("sent %v messages to the supergroup, want the notification", len(sent))
+	}
+	if _, ok := sent[0].Chattable.(tgbotapi.PhotoConfig); !ok {
+		t.Errorf("sent the supergroup %T, want a photo", sent[0].Chattable)
+	}
+	chatSettings, err := bot.repo.GetChatSettings(ctx, supergroupChatId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chatSettings.LatestSSBIssueNotified != issueCode {
+		t.Errorf("the supergroup was notified of %q, want %q", chatSettings.LatestSSBIssueNotified, issueCode)
+	}
+	entries, err := bot.repo.GetNotifications(ctx, issueCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ChatId != supergroupChatId {
+		t.Errorf("outbox entries are %+v, want the supergroup's", entries)
+	}
+}
+
+func TestHandleMigrationIsIdempotent(t *testing.T) {
+	migrateTo := &tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat:            &tgbotapi.Chat{ID: groupChatId},
+		MigrateToChatID: supergroupChatId,
+	}}
+	migrateFrom := &tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat:              &tgbotapi.Chat{ID: supergroupChatId},
+		MigrateFromChatID: groupChatId,
+	}}
+	for name, updates := range map[string][]*tgbotapi.Update{
+		"to then from": {migrateTo, migrateFrom},
+		"from then to": {migrateFrom, migrateTo},
+	} {
+		t.Run(name, func(t *testing.T) {
+			bot := newTestBot(t)
+			subscribeGroup(t, bot)
+			for _, update := range updates {
+				handler.HandleMigration(context.Background(), update, bot.repo)
+			}
+			checkMigrated(t, bot)
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/core"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/masstub"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/repository"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// markInFlight records the notification of the latest issue to chatId as in
+// flight since updatedTime, as a crash while sending leaves it.
+func markInFlight(t *testing.T, bot *testBot, chatId int64, updatedTime time.Time) string {
+	t.Helper()
+	ctx := context.Background()
+	latestBond, err := core.LatestIssue(ctx, bot.masClient, bot.timezone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bot.repo.EnqueueNotifications(ctx, latestBond.IssueCode, []int64{chatId}, updatedTime); err != nil {
+		t.Fatal(err)
+	}
+	err = bot.repo.UpdateNotification(ctx, schemas.OutboxEntry{
+		IssueCode:   latestBond.IssueCode,
+		ChatId:      chatId,
+		Status:      schemas.OutboxStatusInFlight,
+		UpdatedTime: schemas.DatetimeWithoutTimezone(updatedTime),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return latestBond.IssueCode
+}
+
+func TestNotifyDoesNotResendInterruptedSend(t *testing.T) {
+	ctx := context.Background()
+	bot := newTestBot(t)
+	bot.handle(1, "/subscribe")
+	issueCode := markInFlight(t, bot, 1, time.Now().In(bot.timezone).Add(-time.Hour))
+
+	if err := bot.scheduler.NotifySubscribers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sent := len(bot.sender.SentTo(1)); sent != 1 {
+		t.Errorf("sent %v messages to chat 1, want only the subscribe reply", sent)
+	}
+	chatSettings, err := bot.repo.GetChatSettings(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chatSettings.LatestSSBIssueNotified != issueCode {
+		t.Errorf("chat was notified of %q, want %q assumed delivered", chatSettings.LatestSSBIssueNotified, issueCode)
+	}
+}
+
+func TestNotifySkipsSendInFlight(t *testing.T) {
+	ctx := context.Background()
+	bot := newTestBot(t)
+	bot.handle(1, "/subscribe")
+	markInFlight(t, bot, 1, time.Now().In(bot.timezone))
+
+	if err := bot.scheduler.NotifySubscribers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sent := len(bot.sender.SentTo(1)); sent != 1 {
+		t.Errorf("sent %v messages to chat 1, want only the subscribe reply", sent)
+	}
+	chatSettings, err := bot.repo.GetChatSettings(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chatSettings.LatestSSBIssueNotified != "" {
+		t.Errorf("chat was marked notified of %q while the send is in flight", chatSettings.LatestSSBIssueNotified)
+	}
+}
+
+func TestNotifyRecordsInFlightBeforeSending(t *testing.T) {
+	ctx := context.Background()
+	bot := newTestBot(t)
+	bot.handle(1, "/subscribe")
+	latestBond, err := core.LatestIssue(ctx, bot.masClient, bot.timezone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statuses []schemas.OutboxStatus
+	bot.scheduler.Sender = sendHook{Sender: bot.scheduler.Sender, before: func() {
+		entries, err := bot.repo.GetNotifications(ctx, latestBond.IssueCode)
+		if err != nil {
+			t.Error(err)
+		}
+		for _, entry := range entries {
+			statuses = append(statuses, entry.Status)
+		}
+	}}
+
+	if err := bot.scheduler.NotifySubscribers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0] != schemas.OutboxStatusInFlight {
+		t.Errorf("outbox statuses while sending are %v, want [%v]", statuses, schemas.OutboxStatusInFlight)
+	}
+}
+
+// sendHook calls before ahead of every photo sent.
+type sendHook struct {
+	core.Sender
+	before func()
+}
+
+func (s sendHook) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	if _, ok := c.(tgbotapi.PhotoConfig); ok {
+		s.before()
+	}
+	return s.Sender.Send(c)
+}
+
+func TestNotifyDoesNotCountRenderFailuresAgainstChats(t *testing.T) {
+	ctx := context.Background()
+	bot := newTestBot(t)
+	bot.handle(1, "/subscribe")
+	latestBond, err := core.LatestIssue(ctx, bot.masClient, bot.timezone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixtures := masstub.DefaultFixtures().ShiftTo(time.Now().In(bot.timezone).AddDate(0, 1, 0))
+	interests := fixtures.BondInterests
+	fixtures.BondInterests = nil
+	bot.mas.SetFixtures(fixtures)
+
+	// stop retrying the render after the first attempt
+	timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if err := bot.scheduler.NotifySubscribers(timeoutCtx); err == nil {
+		t.Fatal("expected the run to fail without interest records")
+	}
+	entries, err := bot.repo.GetNotifications(ctx, latestBond.IssueCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Attempts != 0 || entry.Status != schemas.OutboxStatusPending {
+			t.Errorf("outbox entry of chat %v is %v after %v attempts, want pending", entry.ChatId, entry.Status, entry.Attempts)
+		}
+	}
+
+	fixtures.BondInterests = interests
+	bot.mas.SetFixtures(fixtures)
+	if err := bot.scheduler.NotifySubscribers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sent := len(bot.sender.SentTo(1)); sent != 2 {
+		t.Errorf("sent %v messages to chat 1, want the subscribe reply and the notification", sent)
+	}
+}
+
+// failingOutbox fails to record failed sends in the outbox.
+type failingOutbox struct {
+	repository.Repository
+}
+
+func (r failingOutbox) UpdateNotification(ctx context.Context, entry schemas.OutboxEntry) error {
+	if entry.Status == schemas.OutboxStatusFailed {
+		return core.Permanent(errors.New("database is locked"))
+	}
+	return r.Repository.UpdateNotification(ctx, entry)
+}
+
+func TestNotifyDoesNotAssumeUnsavedFailureDelivered(t *testing.T) {
+	ctx := context.Background()
+	bot := newTestBot(t)
+	bot.handle(1, "/subscribe")
+	bot.sender.FailChat(1, &tgbotapi.Error{Code: 400, Message: "Bad Request: can't parse entities"})
+	bot.scheduler.Repository = failingOutbox{bot.repo}
+
+	if err := bot.scheduler.NotifySubscribers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// the failure was not saved, and the send has since been in flight for
+	// longer than any send takes
+	issueCode := markInFlight(t, bot, 1, time.Now().In(bot.timezone).Add(-time.Hour))
+	bot.scheduler.Repository = bot.repo
+
+	if err := bot.scheduler.NotifySubscribers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	chatSettings, err := bot.repo.GetChatSettings(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chatSettings.LatestSSBIssueNotified != "" {
+		t.Errorf("chat was marked notified of %q after the send failed", chatSettings.LatestSSBIssueNotified)
+	}
+	entries, err := bot.repo.GetNotifications(ctx, issueCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Status != schemas.OutboxStatusFailed {
+		t.Errorf("outbox entries are %+v, want the failed send", entries)
+	}
+}
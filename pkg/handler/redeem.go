@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/core"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const redeemUsage = "Usage: /redeem <issue code> <amount> <month>, e.g. /redeem SBJAN25 10000 2027-03"
+
+// HandleRedeem works out redeeming a holding with a request in the given
+// month, e.g. "/redeem SBJAN25 10000 2027-03", from the current month on. The
+// reply is formatted as MarkdownV2.
+func HandleRedeem(ctx context.Context, update *tgbotapi.Update, masClient core.MASClient, localTimezone *time.Location) (string, error) {
+	args := strings.Fields(update.Message.CommandArguments())
+	if len(args) != 3 {
+		return escape(redeemUsage), nil
+	}
+	issueCode := strings.ToUpper(args[0])
+	amount, err := strconv.Atoi(args[1])
+	if err != nil || amount <= 0 || amount%core.HoldingAmountMultiple != 0 {
+		return escape(fmt.Sprintf("The amount must be a multiple of %v.", core.FormatDollars(core.HoldingAmountMultiple))), nil
+	}
+	month, err := time.Parse("2006-01", args[2])
+	if err != nil {
+		return escape(redeemUsage), nil
+	}
+	now := time.Now().In(localTimezone)
+	if month.Before(time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)) {
+		return escape(fmt.Sprintf("Cannot redeem in %v, the month has passed.", month.Format("Jan 2006"))), nil
+	}
+
+	bonds, err := core.ListHeldBonds(ctx, masClient, localTimezone, []string{issueCode})
+	if err != nil {
+		return "", err
+	}
+	bondInterests, err := masClient.ListBondInterests(ctx, []string{issueCode})
+	if err != nil {
+		return "", err
+	}
+	bond, ok := bonds[issueCode]
+	interest, hasInterest := bondInterests[issueCode]
+	if !ok || !hasInterest {
+		return escape(fmt.Sprintf("%v is not a savings bonds issue.", issueCode)), nil
+	}
+
+	redemption, err := core.CalculateRedemption(bond, interest, amount, month)
+	if err != nil {
+		return escape(fmt.Sprintf("Cannot redeem in %v: %v.", month.Format("Jan 2006"), err)), nil
+	}
+	windowOpen, windowDeadline := core.RedemptionWindowOpen(bond, now)
+	return core.FormatRedemption(*redemption, windowOpen, windowDeadline), nil
+}
@@ -0,0 +1,28 @@
+package handler_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/masstub"
+)
+
+func TestRedeemRejectsPastMonths(t *testing.T) {
+	bot := newTestBot(t)
+	now := time.Now().In(bot.timezone)
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	issueCode := masstub.IssueCode(thisMonth.AddDate(0, -6, 0))
+
+	lastMonth := thisMonth.AddDate(0, -1, 0)
+	bot.handle(1, fmt.Sprintf("/redeem %v 10000 %v", issueCode, lastMonth.Format("2006-01")))
+	if reply, want := lastReply(t, bot, 1), fmt.Sprintf("Cannot redeem in %v, the month has passed\\.", lastMonth.Format("Jan 2006")); reply != want {
+		t.Errorf("replied %q to redeeming last month, want %q", reply, want)
+	}
+
+	bot.handle(1, fmt.Sprintf("/redeem %v 10000 %v", issueCode, thisMonth.Format("2006-01")))
+	if reply := lastReply(t, bot, 1); strings.HasPrefix(reply, "Cannot redeem") {
+		t.Errorf("replied %q to redeeming this month, want the redemption", reply)
+	}
+}
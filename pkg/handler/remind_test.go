@@ -0,0 +1,132 @@
+package handler_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+)
+
+// closeApplicationsIn moves the last day to apply of the latest issue to
+// days from today.
+func closeApplicationsIn(t *testing.T, bot *testBot, days int) {
+	t.Helper()
+	bot.updateBond(t, 1, func(bond *schemas.SavingsBonds) {
+		bond.AnnDate = daysFromToday(bot.timezone, -1)
+		bond.LastDayToApply = daysFromToday(bot.timezone, days)
+	})
+}
+
+func TestSendRemindersWithinReminderDays(t *testing.T) {
+	ctx := context.Background()
+	bot := newTestBot(t)
+	bot.handle(1, "/subscribe")
+	bot.handle(1, "/remind 5")
+	bot.handle(2, "/subscribe")
+	bot.handle(2, "/remind 2")
+	bot.handle(3, "/subscribe")
+	closeApplicationsIn(t, bot, 3)
+
+	sentBefore := map[int64]int{}
+	for _, chatId := range []int64{1, 2, 3} {
+		sentBefore[chatId] = len(bot.sender.SentTo(chatId))
+	}
+	if err := bot.scheduler.SendReminders(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sent := len(bot.sender.SentTo(1)) - sentBefore[1]; sent != 1 {
+		t.Fatalf("sent %v reminders to chat 1, want 1", sent)
+	}
+	if reply := lastReply(t, bot, 1); !strings.Contains(reply, "close in 3 days") {
+		t.Errorf("reminder is %q, want applications to close in 3 days", reply)
+	}
+	for _, chatId := range []int64{2, 3} {
+		if sent := len(bot.sender.SentTo(chatId)) - sentBefore[chatId]; sent != 0 {
+			t.Errorf("sent %v reminders to chat %v, want none", sent, chatId)
+		}
+	}
+
+	// a day later chat 2 is within its 2 days, and chat 1 was already reminded
+	closeApplicationsIn(t, bot, 2)
+	if err := bot.scheduler.SendReminders(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := bot.scheduler.SendReminders(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for chatId, want := range map[int64]int{1: 1, 2: 1, 3: 0} {
+		if sent := len(bot.sender.SentTo(chatId)) - sentBefore[chatId]; sent != want {
+			t.Errorf("sent %v reminders to chat %v, want %v", sent, chatId, want)
+		}
+	}
+	if reply := lastReply(t, bot, 2); !strings.Contains(reply, "close in 2 days") {
+		t.Errorf("reminder is %q, want applications to close in 2 days", reply)
+	}
+}
+
+func TestSendRemindersAfterLastDayToApply(t *testing.T) {
+	ctx := context.Background()
+	bot := newTestBot(t)
+	bot.handle(1, "/subscribe")
+	bot.handle(1, "/remind 5")
+	closeApplicationsIn(t, bot, -1)
+
+	sentBefore := len(bot.sender.SentTo(1))
+	if err := bot.scheduler.SendReminders(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sent := len(bot.sender.SentTo(1)) - sentBefore; sent != 0 {
+		t.Errorf("sent %v reminders after applications closed, want none", sent)
+	}
+}
+
+func TestRemindOff(t *testing.T) {
+	ctx := context.Background()
+	bot := newTestBot(t)
+	bot.handle(1, "/subscribe")
+	bot.handle(1, "/remind 5")
+	bot.handle(1, "/remind off")
+	if reply := lastReply(t, bot, 1); reply != "You will no longer be reminded before applications close." {
+		t.Errorf("replied %q to /remind off", reply)
+	}
+	bot.handle(1, "/remind")
+	if reply := lastReply(t, bot, 1); !strings.HasPrefix(reply, "Reminders are off.") {
+		t.Errorf("replied %q to /remind, want reminders to be off", reply)
+	}
+	chatSettings, err := bot.repo.GetChatSettings(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chatSettings.ReminderDays != 0 {
+		t.Errorf("reminder days is %v, want 0", chatSettings.ReminderDays)
+	}
+
+	closeApplicationsIn(t, bot, 1)
+	sentBefore := len(bot.sender.SentTo(1))
+	if err := bot.scheduler.SendReminders(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sent := len(bot.sender.SentTo(1)) - sentBefore; sent != 0 {
+		t.Errorf("sent %v reminders with reminders off, want none", sent)
+	}
+}
+
+func TestRemindUsage(t *testing.T) {
+	bot := newTestBot(t)
+	bot.handle(1, "/remind 3")
+	if reply := lastReply(t, bot, 1); !strings.Contains(reply, "/subscribe first") {
+		t.Errorf("replied %q to an unsubscribed chat", reply)
+	}
+	bot.handle(1, "/subscribe")
+	for _, text := range []string{"/remind 0", "/remind 15", "/remind soon"} {
+		bot.handle(1, text)
+		if reply := lastReply(t, bot, 1); !strings.HasPrefix(reply, "Usage: /remind <days>") {
+			t.Errorf("replied %q to %v, want the usage", reply, text)
+		}
+	}
+	bot.handle(1, "/remind 14")
+	if reply := lastReply(t, bot, 1); reply != "You will be reminded 14 days before applications close." {
+		t.Errorf("replied %q to /remind 14", reply)
+	}
+}
@@ -1,74 +1,187 @@
 package handler
 
 import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Jason-CKY/telegram-ssbbot/pkg/core"
-	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/metrics"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/repository"
 	"github.com/Jason-CKY/telegram-ssbbot/pkg/utils"
 	log "github.com/sirupsen/logrus"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
-func HandleUpdate(update *tgbotapi.Update, bot *tgbotapi.BotAPI) {
+func HandleUpdate(ctx context.Context, update *tgbotapi.Update, sender core.Sender, repo repository.Repository, masClient core.MASClient, notifier *core.Notifier, localTimezone *time.Location) {
+	if update.Message != nil && (update.Message.MigrateToChatID != 0 || update.Message.MigrateFromChatID != 0) {
+		HandleMigration(ctx, update, repo)
+		return
+	}
 	if update.Message != nil && utils.IsUsernameAllowed(update.Message.From.UserName) {
 		if update.Message.IsCommand() {
-			HandleCommand(update, bot)
+			HandleCommand(ctx, update, sender, repo, masClient, notifier, localTimezone)
 		}
 	}
 }
 
-func HandleCommand(update *tgbotapi.Update, bot *tgbotapi.BotAPI) {
+// HandleMigration moves the settings of a group upgraded to a supergroup.
+// Telegram sends a service message to both the old group (migrate_to_chat_id)
+// and the new supergroup (migrate_from_chat_id), whichever arrives first
+// migrates and the other finds nothing left to move.
+func HandleMigration(ctx context.Context, update *tgbotapi.Update, chatSettingsRepo repository.ChatSettingsRepository) {
+	fromChatId, toChatId := update.Message.Chat.ID, update.Message.MigrateToChatID
+	if update.Message.MigrateFromChatID != 0 {
+		fromChatId, toChatId = update.Message.MigrateFromChatID, update.Message.Chat.ID
+	}
+	log.Infof("migrating chat settings from %v to %v", fromChatId, toChatId)
+	if err := chatSettingsRepo.MigrateChatSettings(ctx, fromChatId, toChatId); err != nil {
+		log.Error(err)
+	}
+}
+
+func HandleCommand(ctx context.Context, update *tgbotapi.Update, sender core.Sender, repo repository.Repository, masClient core.MASClient, notifier *core.Notifier, localTimezone *time.Location) {
 	// Create a new MessageConfig. We don't have text yet,
 	// so we leave it empty.
 	msg := tgbotapi.NewMessage(update.Message.Chat.ID, "")
 
 	// Extract the command from the Message.
-	switch update.Message.Command() {
+	command := update.Message.Command()
+	defer func() {
+		metrics.CommandsHandled.WithLabelValues(command).Inc()
+	}()
+	switch command {
 	case "help":
 		msg.Text = utils.HELP_MESSAGE
 	case "subscribe":
-		_, _, err := schemas.InsertChatSettingsIfNotPresent(update.Message.Chat.ID)
+		chatSettings, _, err := repository.InsertChatSettingsIfNotPresent(ctx, repo, update.Message.Chat.ID)
 		if err != nil {
 			log.Error(err)
 			return
 		}
+		if chatSettings.UnsubscribedReason != "" {
+			// the chat can be reached again, e.g. the user unblocked the bot
+			chatSettings.UnsubscribedReason = ""
+			if err := repo.UpdateChatSettings(ctx, *chatSettings); err != nil {
+				log.Error(err)
+				return
+			}
+		}
 		msg.Text = "You have subscribed to SSB rate updates."
 	case "unsubscribe":
-		chatSettings, _, err := schemas.InsertChatSettingsIfNotPresent(update.Message.Chat.ID)
+		chatSettings, _, err := repository.InsertChatSettingsIfNotPresent(ctx, repo, update.Message.Chat.ID)
 		if err != nil {
 			log.Error(err)
 			return
 		}
-		err = chatSettings.Delete()
+		err = repo.DeleteChatSettings(ctx, chatSettings.ChatId)
 		if err != nil {
 			log.Error(err)
 			return
 		}
 		msg.Text = "You have unsubscribed to SSB rate updates."
-	case "rates":
-		localTimezone, err := time.LoadLocation("Asia/Singapore") // Look up a location by it's IANA name.
+	case "remind":
+		text, err := HandleRemind(ctx, update, repo)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		msg.Text = text
+	case "hold":
+		text, err := HandleHold(ctx, update, repo, masClient)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		msg.Text = text
+		msg.ParseMode = "MarkdownV2"
+	case "calendar":
+		text, err := HandleCalendar(ctx, update, repo, masClient, localTimezone)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		msg.Text = text
+		msg.ParseMode = "MarkdownV2"
+	case "redeem":
+		text, err := HandleRedeem(ctx, update, masClient, localTimezone)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		msg.Text = text
+		msg.ParseMode = "MarkdownV2"
+	case "switch":
+		text, err := HandleSwitch(ctx, update, repo, masClient, localTimezone)
 		if err != nil {
 			log.Error(err)
 			return
 		}
-		photoConfig, err := core.GenerateNotificationMessage(update.Message.Chat.ID, localTimezone)
+		msg.Text = text
+		msg.ParseMode = "MarkdownV2"
+	case "curve":
+		c, err := HandleCurve(ctx, update, masClient, localTimezone)
 		if err != nil {
 			log.Error(err)
 			return
 		}
-		if _, err := bot.Send(photoConfig); err != nil {
+		if _, err := sender.Request(c); err != nil {
+			log.Error(err)
+		}
+		return
+	case "rates":
+		if _, err := notifier.Send(ctx, sender, update.Message.Chat.ID); err != nil {
 			log.Error(err)
 			return
 		}
 		return
 	default:
+		// keep arbitrary user input out of the metric labels
+		command = "unknown"
 		return
 	}
 
-	if _, err := bot.Request(msg); err != nil {
+	if _, err := sender.Request(msg); err != nil {
 		log.Error(err)
 		return
 	}
 }
+
+// HandleRemind sets how many days before the last day to apply the chat is
+// reminded, "/remind off" stops the reminders and "/remind" shows the setting.
+func HandleRemind(ctx context.Context, update *tgbotapi.Update, chatSettingsRepo repository.ChatSettingsRepository) (string, error) {
+	chatSettings, err := chatSettingsRepo.GetChatSettings(ctx, update.Message.Chat.ID)
+	if err != nil {
+		return "", err
+	}
+	if chatSettings == nil {
+		return "Reminders are only sent to subscribed chats, /subscribe first.", nil
+	}
+
+	args := strings.TrimSpace(update.Message.CommandArguments())
+	switch {
+	case args == "":
+		if chatSettings.ReminderDays == 0 {
+			return "Reminders are off. Use /remind <days> to be reminded before applications close.", nil
+		}
+		return fmt.Sprintf("You will be reminded %v days before applications close.", chatSettings.ReminderDays), nil
+	case args == "off":
+		chatSettings.ReminderDays = 0
+	default:
+		days, err := strconv.Atoi(args)
+		if err != nil || days < 1 || days > core.MaxReminderDays {
+			return fmt.Sprintf("Usage: /remind <days> with between 1 and %v days, or /remind off", core.MaxReminderDays), nil
+		}
+		chatSettings.ReminderDays = days
+	}
+	if err := chatSettingsRepo.UpdateChatSettings(ctx, *chatSettings); err != nil {
+		return "", err
+	}
+	if chatSettings.ReminderDays == 0 {
+		return "You will no longer be reminded before applications close.", nil
+	}
+	return fmt.Sprintf("You will be reminded %v days before applications close.", chatSettings.ReminderDays), nil
+}
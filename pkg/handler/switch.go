@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/core"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/repository"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const switchUsage = "Usage: /switch <issue code> [amount], e.g. /switch SBJAN23. The amount defaults to your holding of the issue."
+
+// HandleSwitch compares keeping a holding to maturity against redeeming it
+// and reinvesting in the next issue, e.g. "/switch SBJAN23 [amount]". The
+// reply is formatted as MarkdownV2.
+func HandleSwitch(ctx context.Context, update *tgbotapi.Update, holdingsRepo repository.HoldingsRepository, masClient core.MASClient, localTimezone *time.Location) (string, error) {
+	args := strings.Fields(update.Message.CommandArguments())
+	if len(args) != 1 && len(args) != 2 {
+		return escape(switchUsage), nil
+	}
+	issueCode := strings.ToUpper(args[0])
+	var amount int
+	if len(args) == 2 {
+		var err error
+		amount, err = strconv.Atoi(args[1])
+		if err != nil || amount <= 0 || amount%core.HoldingAmountMultiple != 0 {
+			return escape(fmt.Sprintf("The amount must be a multiple of %v.", core.FormatDollars(core.HoldingAmountMultiple))), nil
+		}
+	} else {
+		holdings, err := holdingsRepo.GetHoldings(ctx, update.Message.Chat.ID)
+		if err != nil {
+			return "", err
+		}
+		amount = holdingAmount(holdings, issueCode)
+		if amount == 0 {
+			return escape(fmt.Sprintf("You do not hold %v. Add it with /hold add %v <amount>, or give the amount: /switch %v <amount>.", issueCode, issueCode, issueCode)), nil
+		}
+	}
+
+	latestBond, err := core.LatestIssue(ctx, masClient, localTimezone)
+	if err != nil {
+		return "", err
+	}
+	if latestBond.IssueCode == issueCode {
+		return escape(fmt.Sprintf("%v is the latest issue.", issueCode)), nil
+	}
+	bonds, err := core.ListHeldBonds(ctx, masClient, localTimezone, []string{issueCode})
+	if err != nil {
+		return "", err
+	}
+	bondInterests, err := masClient.ListBondInterests(ctx, []string{issueCode, latestBond.IssueCode})
+	if err != nil {
+		return "", err
+	}
+	bond, ok := bonds[issueCode]
+	interest, hasInterest := bondInterests[issueCode]
+	if !ok || !hasInterest {
+		return escape(fmt.Sprintf("%v is not a savings bonds issue.", issueCode)), nil
+	}
+	latestInterest, ok := bondInterests[latestBond.IssueCode]
+	if !ok {
+		return "", fmt.Errorf("no interest rates for the latest issue %v", latestBond.IssueCode)
+	}
+
+	comparison, err := core.CompareSwitch(bond, interest, latestInterest, amount, time.Now().In(localTimezone))
+	if err != nil {
+		return escape(fmt.Sprintf("Cannot switch %v: %v.", issueCode, err)), nil
+	}
+	return core.FormatSwitchComparison(*comparison), nil
+}
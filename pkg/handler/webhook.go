@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// WebhookHandler receives updates pushed by telegram, rejecting requests
+// without the secret token the webhook was registered with.
+type WebhookHandler struct {
+	secretToken string
+	updates     chan tgbotapi.Update
+	stopped     chan struct{}
+	stopOnce    sync.Once
+}
+
+func NewWebhookHandler(secretToken string, buffer int) (*WebhookHandler, error) {
+	// an empty token would accept requests without the header
+	if secretToken == "" {
+		return nil, errors.New("webhook secret token must not be empty")
+	}
+	return &WebhookHandler{
+		secretToken: secretToken,
+		updates:     make(chan tgbotapi.Update, buffer),
+		stopped:     make(chan struct{}),
+	}, nil
+}
+
+// Stop rejects updates that are not yet queued, telegram delivers them again
+// once the webhook is registered on the next start.
+func (h *WebhookHandler) Stop() {
+	h.stopOnce.Do(func() { close(h.stopped) })
+}
+
+func (h *WebhookHandler) Updates() tgbotapi.UpdatesChannel {
+	return h.updates
+}
+
+// Drain calls handle with every update still queued. Telegram was told these
+// were delivered, so they are not sent again. It must be called once the
+// server has stopped, when no more updates can be queued.
+func (h *WebhookHandler) Drain(handle func(update tgbotapi.Update)) {
+	for {
+		select {
+		case update := <-h.updates:
+			handle(update)
+		default:
+			return
+		}
+	}
+}
+
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(secretTokenHeader)), []byte(h.secretToken)) != 1 {
+		log.Warnf("rejected webhook request from %v with an invalid secret token", r.RemoteAddr)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var update tgbotapi.Update
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	select {
+	case <-h.stopped:
+		// checked first as select picks at random when the queue has room
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	default:
+	}
+	select {
+	case h.updates <- update:
+		w.WriteHeader(http.StatusOK)
+	case <-h.stopped:
+		// telegram retries the update later
+		w.WriteHeader(http.StatusServiceUnavailable)
+	case <-r.Context().Done():
+	}
+}
+
+// SetWebhook registers url with telegram. setWebhook is called directly as
+// tgbotapi.WebhookConfig does not support secret_token.
+func SetWebhook(bot *tgbotapi.BotAPI, url string, secretToken string) error {
+	params := tgbotapi.Params{
+		"url":          url,
+		"secret_token": secretToken,
+	}
+	resp, err := bot.MakeRequest("setWebhook", params)
+	if err != nil {
+		return err
+	}
+	if !resp.Ok {
+		return fmt.Errorf("error setting webhook: %v", resp.Description)
+	}
+	log.Infof("registered webhook %v", url)
+	return nil
+}
+
+// DeleteWebhook deregisters the webhook, which is also needed before long
+// polling as telegram rejects getUpdates while a webhook is set.
+func DeleteWebhook(bot *tgbotapi.BotAPI) error {
+	_, err := bot.Request(tgbotapi.DeleteWebhookConfig{})
+	return err
+}
+
+// ListenForWebhook serves the webhook handler at path on addr until ctx is
+// done, then gives in-flight requests up to shutdownTimeout to finish.
+func ListenForWebhook(ctx context.Context, addr string, path string, webhookHandler *WebhookHandler, shutdownTimeout time.Duration) error {
+	mux := http.NewServeMux()
+	mux.Handle(path, webhookHandler)
+	log.Infof("listening for webhook on %v%v", addr, path)
+	return listenAndServe(ctx, &http.Server{Addr: addr, Handler: mux}, shutdownTimeout, webhookHandler.Stop)
+}
+
+// listenAndServe runs server until ctx is done, calling beforeShutdown (if
+// any) before giving in-flight requests up to shutdownTimeout to finish.
+func listenAndServe(ctx context.Context, server *http.Server, shutdownTimeout time.Duration, beforeShutdown func()) error {
+	go func() {
+		<-ctx.Done()
+		if beforeShutdown != nil {
+			beforeShutdown()
+		}
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Errorf("error shutting down http server on %v: %v", server.Addr, err)
+		}
+	}()
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/handler"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func postUpdate(h http.Handler, secretToken string, updateId int) int {
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(`{"update_id":`+strconv.Itoa(updateId)+`}`))
+	req.Header.Set("X-Telegram-Bot-Api-Secret-Token", secretToken)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func newWebhookHandler(t *testing.T) *handler.WebhookHandler {
+	t.Helper()
+	h, err := handler.NewWebhookHandler("secret", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestNewWebhookHandlerRejectsEmptySecretToken(t *testing.T) {
+	if _, err := handler.NewWebhookHandler("", 10); err == nil {
+		t.Error("expected an error for an empty secret token")
+	}
+}
+
+func TestWebhookRejectsInvalidSecretToken(t *testing.T) {
+	h := newWebhookHandler(t)
+	for _, secretToken := range []string{"wrong", ""} {
+		if code := postUpdate(h, secretToken, 1); code != http.StatusUnauthorized {
+			t.Errorf("status with secret token %q is %v, want %v", secretToken, code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestWebhookDrainsQueuedUpdatesAfterStop(t *testing.T) {
+	h := newWebhookHandler(t)
+	for updateId := 1; updateId <= 3; updateId++ {
+		if code := postUpdate(h, "secret", updateId); code != http.StatusOK {
+			t.Fatalf("status of update %v is %v, want %v", updateId, code, http.StatusOK)
+		}
+	}
+	h.Stop()
+	if code := postUpdate(h, "secret", 4); code != http.StatusServiceUnavailable {
+		t.Errorf("status after stopping is %v, want %v", code, http.StatusServiceUnavailable)
+	}
+
+	var drained []int
+	h.Drain(func(update tgbotapi.Update) {
+		drained = append(drained, update.UpdateID)
+	})
+	if len(drained) != 3 || drained[0] != 1 || drained[2] != 3 {
+		t.Errorf("drained updates %v, want [1 2 3]", drained)
+	}
+}
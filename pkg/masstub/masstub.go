@@ -0,0 +1,282 @@
+// Package masstub serves the MAS listsavingbonds and savingbondsinterest
+// endpoints from fixtures, so the bot can run against it offline in tests and
+// staging by pointing MAS_BASE_URL at the stub.
+package masstub
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+)
+
+//go:embed fixtures/*.json
+var fixturesFS embed.FS
+
+// Fixtures are the bond and interest records served by the stub.
+type Fixtures struct {
+	Bonds         []schemas.SavingsBonds
+	BondInterests []schemas.BondInterest
+}
+
+// DefaultFixtures returns the bundled fixtures of 24 monthly issues from
+// SBDEC24 to SBNOV26, latest first. SBNOV26 has been announced but not tendered.
+// The bundled records are synthetic, in the format of the MAS api; replace them
+// with a capture of the real api with scripts/masstub/record-fixtures.sh.
+func DefaultFixtures() Fixtures {
+	var bondsResponse schemas.ListSavingsBondsResponse
+	var bondInterestsResponse schemas.ListSavingsBondsInterestResponse
+	mustUnmarshalFixture("fixtures/listsavingbonds.json", &bondsResponse)
+	mustUnmarshalFixture("fixtures/savingbondsinterest.json", &bondInterestsResponse)
+	return Fixtures{
+		Bonds:         bondsResponse.Result.Records,
+		BondInterests: bondInterestsResponse.Result.Records,
+	}
+}
+
+func mustUnmarshalFixture(name string, v any) {
+	data, err := fixturesFS.ReadFile(name)
+	if err != nil {
+		panic(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		panic(fmt.Errorf("error parsing masstub fixture %v: %w", name, err))
+	}
+}
+
+// ShiftTo moves every date in the fixtures by whole months so that the latest
+// issue is issued in the month of latestIssueDate, and renames the issue codes
+// to match. This keeps tests that query relative to time.Now() deterministic.
+func (f Fixtures) ShiftTo(latestIssueDate time.Time) Fixtures {
+	if len(f.Bonds) == 0 {
+		return f
+	}
+	latest := f.Bonds[0]
+	for _, bond := range f.Bonds {
+		if time.Time(bond.IssueDate).After(time.Time(latest.IssueDate)) {
+			latest = bond
+		}
+	}
+	latestIssue := time.Time(latest.IssueDate)
+	months := (latestIssueDate.Year()-latestIssue.Year())*12 + int(latestIssueDate.Month()) - int(latestIssue.Month())
+
+	shiftDate := func(d schemas.BondDate) schemas.BondDate {
+		if time.Time(d).IsZero() {
+			return d
+		}
+		return schemas.BondDate(addMonths(time.Time(d), months))
+	}
+	renamed := make(map[string]string, len(f.Bonds))
+	shifted := Fixtures{}
+	for _, bond := range f.Bonds {
+		bond.IssueDate = shiftDate(bond.IssueDate)
+		bond.MaturityDate = shiftDate(bond.MaturityDate)
+		bond.FirstInterestDate = shiftDate(bond.FirstInterestDate)
+		bond.SBInt1 = shiftDate(bond.SBInt1)
+		bond.SBInt2 = shiftDate(bond.SBInt2)
+		bond.AnnDate = shiftDate(bond.AnnDate)
+		bond.LastDayToApply = shiftDate(bond.LastDayToApply)
+		bond.TenderDate = shiftDate(bond.TenderDate)
+		bond.StartOfRedemption = shiftDate(bond.StartOfRedemption)
+		bond.EndOfRedemption = shiftDate(bond.EndOfRedemption)
+		bond.PaymentMonth = paymentMonths(time.Time(bond.IssueDate))
+		issueCode := IssueCode(time.Time(bond.IssueDate))
+		renamed[bond.IssueCode] = issueCode
+		bond.IssueCode = issueCode
+		shifted.Bonds = append(shifted.Bonds, bond)
+	}
+	for _, bondInterest := range f.BondInterests {
+		if issueCode, ok := renamed[bondInterest.IssueCode]; ok {
+			bondInterest.IssueCode = issueCode
+		}
+		shifted.BondInterests = append(shifted.BondInterests, bondInterest)
+	}
+	return shifted
+}
+
+// addMonths moves date by whole months, keeping the day of the month unless
+// the month is shorter, e.g. 31 Mar plus one month is 30 Apr rather than the
+// 1 May time.AddDate normalizes it to.
+func addMonths(date time.Time, months int) time.Time {
+	firstOfMonth := time.Date(date.Year(), date.Month()+time.Month(months), 1, 0, 0, 0, 0, date.Location())
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	return time.Date(firstOfMonth.Year(), firstOfMonth.Month(), min(date.Day(), lastDay), date.Hour(), date.Minute(), date.Second(), date.Nanosecond(), date.Location())
+}
+
+// IssueCode returns the fixture issue code of a bond issued on issueDate, e.g. SBJAN25.
+func IssueCode(issueDate time.Time) string {
+	return fmt.Sprintf("SB%v%02d", strings.ToUpper(issueDate.Format("Jan")), issueDate.Year()%100)
+}
+
+func paymentMonths(issueDate time.Time) string {
+	months := []time.Month{issueDate.Month(), issueDate.AddDate(0, 6, 0).Month()}
+	sort.Slice(months, func(i, j int) bool { return months[i] < months[j] })
+	return months[0].String()[:3] + "," + months[1].String()[:3]
+}
+
+// Server is an http.Handler serving Fixtures in the MAS API response format.
+type Server struct {
+	mu       sync.Mutex
+	fixtures Fixtures
+	requests map[string]int
+}
+
+func NewServer(fixtures Fixtures) *Server {
+	return &Server{
+		fixtures: fixtures,
+		requests: make(map[string]int),
+	}
+}
+
+// SetFixtures replaces the served records, e.g. to publish a new issue mid-test.
+func (s *Server) SetFixtures(fixtures Fixtures) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fixtures = fixtures
+}
+
+// Requests returns how many requests were made to endpoint, e.g. "listsavingbonds".
+func (s *Server) Requests(endpoint string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[endpoint]
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	endpoint := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	s.mu.Lock()
+	s.requests[endpoint]++
+	fixtures := s.fixtures
+	s.mu.Unlock()
+
+	query := r.URL.Query()
+	filter, err := parseFilter(query.Get("filters"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rows := -1
+	if rowsParam := query.Get("rows"); rowsParam != "" {
+		if rows, err = strconv.Atoi(rowsParam); err != nil {
+			http.Error(w, fmt.Sprintf("invalid rows: %v", rowsParam), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var records []any
+	switch endpoint {
+	case "listsavingbonds":
+		bonds := append([]schemas.SavingsBonds(nil), fixtures.Bonds...)
+		if err := sortBonds(bonds, query.Get("sort")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, bond := range bonds {
+			if filter.matches(bond.IssueCode, time.Time(bond.IssueDate)) {
+				records = append(records, bond)
+			}
+		}
+	case "savingbondsinterest":
+		for _, bondInterest := range fixtures.BondInterests {
+			if filter.matches(bondInterest.IssueCode, time.Time{}) {
+				records = append(records, bondInterest)
+			}
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	total := len(records)
+	if rows >= 0 && rows < len(records) {
+		records = records[:rows]
+	}
+	if records == nil {
+		records = []any{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"success": true,
+		"result": map[string]any{
+			"total":   total,
+			"records": records,
+		},
+	})
+}
+
+func sortBonds(bonds []schemas.SavingsBonds, sortParam string) error {
+	if sortParam == "" {
+		return nil
+	}
+	field, order, _ := strings.Cut(sortParam, " ")
+	if field != "issue_date" {
+		return fmt.Errorf("unsupported sort field: %v", field)
+	}
+	sort.SliceStable(bonds, func(i, j int) bool {
+		if order == "desc" {
+			return time.Time(bonds[i].IssueDate).After(time.Time(bonds[j].IssueDate))
+		}
+		return time.Time(bonds[i].IssueDate).Before(time.Time(bonds[j].IssueDate))
+	})
+	return nil
+}
+
+// filter is a parsed "filters" query parameter. Only the forms the bot sends
+// are supported: issue_date:[a TO b], issue_code:A and issue_code:(A OR B).
+type filter struct {
+	issueCodes []string
+	from, to   time.Time
+}
+
+func parseFilter(filters string) (filter, error) {
+	if filters == "" {
+		return filter{}, nil
+	}
+	field, value, ok := strings.Cut(filters, ":")
+	if !ok {
+		return filter{}, fmt.Errorf("invalid filters: %v", filters)
+	}
+	switch field {
+	case "issue_code":
+		value = strings.TrimSuffix(strings.TrimPrefix(value, "("), ")")
+		return filter{issueCodes: strings.Split(value, " OR ")}, nil
+	case "issue_date":
+		from, to, ok := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(value, "["), "]"), " TO ")
+		if !ok {
+			return filter{}, fmt.Errorf("invalid issue_date range: %v", value)
+		}
+		fromDate, err := time.Parse(time.DateOnly, from)
+		if err != nil {
+			return filter{}, err
+		}
+		toDate, err := time.Parse(time.DateOnly, to)
+		if err != nil {
+			return filter{}, err
+		}
+		return filter{from: fromDate, to: toDate}, nil
+	default:
+		return filter{}, fmt.Errorf("unsupported filter field: %v", field)
+	}
+}
+
+func (f filter) matches(issueCode string, issueDate time.Time) bool {
+	if len(f.issueCodes) > 0 {
+		for _, code := range f.issueCodes {
+			if code == issueCode {
+				return true
+			}
+		}
+		return false
+	}
+	if !f.from.IsZero() && (issueDate.Before(f.from) || issueDate.After(f.to)) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,115 @@
+package masstub_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/core"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/masstub"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+)
+
+var latestIssueDate = time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+
+func newClient(t *testing.T, fixtures masstub.Fixtures) *core.HTTPMASClient {
+	t.Helper()
+	srv := httptest.NewServer(masstub.NewServer(fixtures))
+	t.Cleanup(srv.Close)
+	return core.NewMASClient(core.MASClientConfig{BaseURL: srv.URL})
+}
+
+func TestListBondsHonoursRowsAndSort(t *testing.T) {
+	client := newClient(t, masstub.DefaultFixtures().ShiftTo(latestIssueDate))
+	bonds, err := client.ListBonds(context.Background(), latestIssueDate.AddDate(-5, 0, 0), latestIssueDate, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*bonds) != 3 {
+		t.Fatalf("got %v bonds, want 3", len(*bonds))
+	}
+	for i, want := range []string{"SBNOV26", "SBOCT26", "SBSEP26"} {
+		if got := (*bonds)[i].IssueCode; got != want {
+			t.Errorf("bond %v is %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestListBondsFiltersIssueDate(t *testing.T) {
+	client := newClient(t, masstub.DefaultFixtures().ShiftTo(latestIssueDate))
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	bonds, err := client.ListBonds(context.Background(), from, to, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// both ends of the range are inclusive
+	if len(*bonds) != 3 {
+		t.Fatalf("got %v bonds, want 3", len(*bonds))
+	}
+	for _, bond := range *bonds {
+		issueDate := time.Time(bond.IssueDate)
+		if issueDate.Before(from) || issueDate.After(to) {
+			t.Errorf("%v issued on %v is outside the range", bond.IssueCode, issueDate.Format(time.DateOnly))
+		}
+	}
+}
+
+func TestListBondInterestsFiltersIssueCodes(t *testing.T) {
+	client := newClient(t, masstub.DefaultFixtures().ShiftTo(latestIssueDate))
+	bondInterests, err := client.ListBondInterests(context.Background(), []string{"SBJAN26", "SBNOV26", "SBXXX"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bondInterests) != 2 {
+		t.Fatalf("got %v interest records, want 2", len(bondInterests))
+	}
+	for _, issueCode := range []string{"SBJAN26", "SBNOV26"} {
+		if _, ok := bondInterests[issueCode]; !ok {
+			t.Errorf("missing interest record of %v", issueCode)
+		}
+	}
+
+	if _, err := client.GetBondInterest(context.Background(), "SBXXX"); err == nil {
+		t.Error("expected an error for an unknown issue code")
+	}
+}
+
+func TestShiftToKeepsEndOfMonth(t *testing.T) {
+	fixtures := masstub.Fixtures{
+		Bonds: []schemas.SavingsBonds{{
+			IssueCode:      "SBAPR26",
+			IssueDate:      schemas.BondDate(time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)),
+			LastDayToApply: schemas.BondDate(time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC)),
+		}},
+	}
+	shifted := fixtures.ShiftTo(time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC))
+	bond := shifted.Bonds[0]
+	if bond.IssueCode != "SBMAY26" {
+		t.Errorf("issue code is %v, want SBMAY26", bond.IssueCode)
+	}
+	if got := time.Time(bond.LastDayToApply).Format(time.DateOnly); got != "2026-04-30" {
+		t.Errorf("last day to apply is %v, want 2026-04-30", got)
+	}
+}
+
+func TestListBondInterestsSkipsInvalidRecords(t *testing.T) {
+	fixtures := masstub.DefaultFixtures().ShiftTo(latestIssueDate)
+	for i := range fixtures.BondInterests {
+		if fixtures.BondInterests[i].IssueCode == "SBOCT26" {
+			fixtures.BondInterests[i].Year1Coupon = 0
+		}
+	}
+	client := newClient(t, fixtures)
+	bondInterests, err := client.ListBondInterests(context.Background(), []string{"SBOCT26", "SBNOV26"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := bondInterests["SBOCT26"]; ok {
+		t.Error("returned the record without a year 1 coupon")
+	}
+	if _, ok := bondInterests["SBNOV26"]; !ok {
+		t.Error("dropped the valid record along with the invalid one")
+	}
+}
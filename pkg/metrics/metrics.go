@@ -0,0 +1,70 @@
+// Package metrics holds the prometheus metrics of the bot, registered on the
+// default registry and served at /metrics.
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	CommandsHandled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ssbbot_commands_handled_total",
+		Help: "Bot commands handled, by command.",
+	}, []string{"command"})
+
+	NotificationsSent = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ssbbot_notifications_sent_total",
+		Help: "Scheduled notifications delivered to a chat.",
+	})
+
+	NotificationsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ssbbot_notifications_failed_total",
+		Help: "Scheduled notifications that could not be delivered after retrying, by telegram error kind.",
+	}, []string{"kind"})
+
+	MASRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ssbbot_mas_request_duration_seconds",
+		Help:    "Latency of requests to the MAS api, by endpoint and outcome.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 9),
+	}, []string{"endpoint", "outcome"})
+
+	ChartRenderDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "ssbbot_chart_render_duration_seconds",
+		Help:    "Time taken to render a chart.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 9),
+	})
+)
+
+// subscriberCountTimeout bounds the storage query made on every scrape.
+const subscriberCountTimeout = 5 * time.Second
+
+// RegisterSubscriberCount exposes the number of subscribed chats, counted by
+// count whenever the metrics are scraped.
+func RegisterSubscriberCount(count func(ctx context.Context) (int, error)) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "ssbbot_subscribers",
+		Help: "Chats subscribed to notifications.",
+	}, func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), subscriberCountTimeout)
+		defer cancel()
+		subscribers, err := count(ctx)
+		if err != nil {
+			log.Errorf("error counting subscribers: %v", err)
+			return -1
+		}
+		return float64(subscribers)
+	})
+}
+
+// Outcome labels a request as "success" or "error".
+func Outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
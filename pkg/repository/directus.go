@@ -0,0 +1,657 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+)
+
+// DirectusRepository stores ChatSettings in the ssbbot_chat_settings directus
+// collection, the notification outbox in ssbbot_notification_outbox and
+// holdings in ssbbot_holdings.
+type DirectusRepository struct {
+	host   string
+	token  string
+	client *http.Client
+}
+
+func NewDirectusRepository(host string, token string) *DirectusRepository {
+	return &DirectusRepository{
+		host:   host,
+		token:  token,
+		client: &http.Client{},
+	}
+}
+
+func (r *DirectusRepository) CreateChatSettings(ctx context.Context, chatSettings schemas.ChatSettings) error {
+	endpoint := fmt.Sprintf("%v/items/ssbbot_chat_settings", r.host)
+	reqBody, _ := json.Marshal(chatSettings)
+	req, httpErr := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", r.token))
+	if httpErr != nil {
+		return httpErr
+	}
+	res, httpErr := r.client.Do(req)
+	if httpErr != nil {
+		return httpErr
+	}
+	body, _ := io.ReadAll(res.Body)
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return fmt.Errorf("error inserting chat settings to directus: %v", string(body))
+	}
+
+	return nil
+}
+
+func (r *DirectusRepository) UpdateChatSettings(ctx context.Context, chatSettings schemas.ChatSettings) error {
+	endpoint := fmt.Sprintf("%v/items/ssbbot_chat_settings/%v", r.host, chatSettings.ChatId)
+	reqBody, _ := json.Marshal(chatSettings)
+	req, httpErr := http.NewRequestWithContext(ctx, http.MethodPatch, endpoint, bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", r.token))
+	if httpErr != nil {
+		return httpErr
+	}
+	res, httpErr := r.client.Do(req)
+	if httpErr != nil {
+		return httpErr
+	}
+	body, _ := io.ReadAll(res.Body)
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return fmt.Errorf("error updating chat settings to directus: %v", string(body))
+	}
+
+	return nil
+
+}
+
+func (r *DirectusRepository) DeleteChatSettings(ctx context.Context, chatId int64) error {
+	endpoint := fmt.Sprintf("%v/items/ssbbot_chat_settings/%v", r.host, chatId)
+	req, httpErr := http.NewRequestWithContext(ctx, http.MethodDelete, endpoint, nil)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", r.token))
+	if httpErr != nil {
+		return httpErr
+	}
+	res, httpErr := r.client.Do(req)
+	if httpErr != nil {
+		return httpErr
+	}
+	body, _ := io.ReadAll(res.Body)
+	defer res.Body.Close()
+	if res.StatusCode != 204 {
+		return fmt.Errorf("error deleting chat settings in directus: %v", string(body))
+	}
+	return nil
+}
+
+func (r *DirectusRepository) GetChatSettings(ctx context.Context, chatId int64) (*schemas.ChatSettings, error) {
+	endpoint := fmt.Sprintf("%v/items/ssbbot_chat_settings", r.host)
+	reqBody := []byte(fmt.Sprintf(`{
+		"query": {
+			"filter": {
+				"chat_id": {
+					"_eq": "%v"
+				}
+			}
+		}
+	}`, chatId))
+	req, httpErr := http.NewRequestWithContext(ctx, "SEARCH", endpoint, bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", r.token))
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	res, httpErr := r.client.Do(req)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("error getting chat settings in directus: %v", string(body))
+	}
+	var chatSettingsResponse map[string][]schemas.ChatSettings
+	jsonErr := json.Unmarshal(body, &chatSettingsResponse)
+	// error handling for json unmarshaling
+	if jsonErr != nil {
+		return nil, jsonErr
+	}
+
+	if len(chatSettingsResponse["data"]) == 0 {
+		return nil, nil
+	}
+
+	return &chatSettingsResponse["data"][0], nil
+}
+
+func (r *DirectusRepository) GetUsersToNotify(ctx context.Context, issueCode string) ([]schemas.ChatSettings, error) {
+	endpoint := fmt.Sprintf("%v/items/ssbbot_chat_settings", r.host)
+	reqBody := fmt.Appendf(nil, `{
+		"query": {
+			"filter": {
+				"_and": [
+					{
+						"_or": [
+							{
+								"latest_ssb_issue_notified": {
+									"_neq": %q
+								}
+							},
+							{
+								"latest_ssb_issue_notified": {
+									"_null": true
+								}
+							}
+						]
+					},
+					{
+						"_or": [
+							{
+								"unsubscribed_reason": {
+									"_null": true
+								}
+							},
+							{
+								"unsubscribed_reason": {
+									"_empty": true
+								}
+							}
+						]
+					}
+				]
+			},
+			"limit": -1
+		}
+	}`, issueCode)
+	req, httpErr := http.NewRequestWithContext(ctx, "SEARCH", endpoint, bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", r.token))
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	res, httpErr := r.client.Do(req)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("error searching for reminder in directus: %v", string(body))
+	}
+	var reminderResponse map[string][]schemas.ChatSettings
+	jsonErr := json.Unmarshal(body, &reminderResponse)
+	// error handling for json unmarshaling
+	if jsonErr != nil {
+		return nil, jsonErr
+	}
+
+	return reminderResponse["data"], nil
+}
+
+// MigrateChatSettings creates the new chat's settings before deleting the old
+// ones, as directus cannot update a primary key. If the process stops in
+// between, calling it again finishes the migration.
+func (r *DirectusRepository) MigrateChatSettings(ctx context.Context, fromChatId int64, toChatId int64) error {
+	// holdings are kept whether or not the chat is subscribed
+	if err := r.migrateHoldings(ctx, fromChatId, toChatId); err != nil {
+		return err
+	}
+	oldChatSettings, err := r.GetChatSettings(ctx, fromChatId)
+	if err != nil || oldChatSettings == nil {
+		return err
+	}
+	newChatSettings, err := r.GetChatSettings(ctx, toChatId)
+	if err != nil {
+		return err
+	}
+	if newChatSettings == nil {
+		oldChatSettings.ChatId = toChatId
+		if err := r.CreateChatSettings(ctx, *oldChatSettings); err != nil {
+			return err
+		}
+	}
+	if err := r.migrateNotifications(ctx, fromChatId, toChatId); err != nil {
+		return err
+	}
+	return r.DeleteChatSettings(ctx, fromChatId)
+}
+
+func (r *DirectusRepository) request(ctx context.Context, method string, endpoint string, reqBody []byte) ([]byte, int, error) {
+	req, httpErr := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%v%v", r.host, endpoint), bytes.NewBuffer(reqBody))
+	if httpErr != nil {
+		return nil, 0, httpErr
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", r.token))
+	res, httpErr := r.client.Do(req)
+	if httpErr != nil {
+		return nil, 0, httpErr
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	return body, res.StatusCode, nil
+}
+
+func (r *DirectusRepository) EnqueueNotifications(ctx context.Context, issueCode string, chatIds []int64, enqueuedTime time.Time) error {
+	entries, err := r.GetNotifications(ctx, issueCode)
+	if err != nil {
+		return err
+	}
+	enqueued := make(map[int64]bool, len(entries))
+	for _, entry := range entries {
+		enqueued[entry.ChatId] = true
+	}
+	var newEntries []schemas.OutboxEntry
+	for _, chatId := range chatIds {
+		if !enqueued[chatId] {
+			newEntries = append(newEntries, schemas.OutboxEntry{
+				IssueCode:   issueCode,
+				ChatId:      chatId,
+				Status:      schemas.OutboxStatusPending,
+				UpdatedTime: schemas.DatetimeWithoutTimezone(enqueuedTime),
+			})
+		}
+	}
+	if len(newEntries) == 0 {
+		return nil
+	}
+	reqBody, _ := json.Marshal(newEntries)
+	body, statusCode, err := r.request(ctx, http.MethodPost, "/items/ssbbot_notification_outbox", reqBody)
+	if err != nil {
+		return err
+	}
+	if statusCode != 200 && statusCode != 204 {
+		return fmt.Errorf("error enqueueing notifications in directus: %v", string(body))
+	}
+	return nil
+}
+
+func (r *DirectusRepository) GetNotifications(ctx context.Context, issueCode string) ([]schemas.OutboxEntry, error) {
+	reqBody := fmt.Appendf(nil, `{
+		"query": {
+			"filter": {
+				"issue_code": {
+					"_eq": %q
+				}
+			},
+			"limit": -1
+		}
+	}`, issueCode)
+	body, statusCode, err := r.request(ctx, "SEARCH", "/items/ssbbot_notification_outbox", reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if statusCode != 200 {
+		return nil, fmt.Errorf("error getting notification outbox in directus: %v", string(body))
+	}
+	var outboxResponse map[string][]schemas.OutboxEntry
+	if jsonErr := json.Unmarshal(body, &outboxResponse); jsonErr != nil {
+		return nil, jsonErr
+	}
+	return outboxResponse["data"], nil
+}
+
+// UpdateNotification updates the entry by query, as entries are looked up by
+// issue code and chat id rather than their directus primary key.
+func (r *DirectusRepository) UpdateNotification(ctx context.Context, entry schemas.OutboxEntry) error {
+	data, _ := json.Marshal(entry)
+	reqBody := fmt.Appendf(nil, `{
+		"query": {
+			"filter": {
+				"issue_code": {
+					"_eq": %q
+				},
+				"chat_id": {
+					"_eq": "%v"
+				}
+			}
+		},
+		"data": %s
+	}`, entry.IssueCode, entry.ChatId, data)
+	body, statusCode, err := r.request(ctx, http.MethodPatch, "/items/ssbbot_notification_outbox", reqBody)
+	if err != nil {
+		return err
+	}
+	if statusCode != 200 && statusCode != 204 {
+		return fmt.Errorf("error updating notification outbox in directus: %v", string(body))
+	}
+	return nil
+}
+
+func (r *DirectusRepository) migrateNotifications(ctx context.Context, fromChatId int64, toChatId int64) error {
+	reqBody := fmt.Appendf(nil, `{
+		"query": {
+			"filter": {
+				"chat_id": {
+					"_eq": "%v"
+				}
+			}
+		},
+		"data": {
+			"chat_id": "%v"
+		}
+	}`, fromChatId, toChatId)
+	body, statusCode, err := r.request(ctx, http.MethodPatch, "/items/ssbbot_notification_outbox", reqBody)
+	if err != nil {
+		return err
+	}
+	if statusCode != 200 && statusCode != 204 {
+		return fmt.Errorf("error migrating notification outbox in directus: %v", string(body))
+	}
+	return nil
+}
+
+func (r *DirectusRepository) PruneNotifications(ctx context.Context, before time.Time) error {
+	reqBody := fmt.Appendf(nil, `{
+		"query": {
+			"filter": {
+				"updated_time": {
+					"_lt": %q
+				}
+			},
+			"limit": -1
+		}
+	}`, before.Format(schemas.DatetimeWithoutTimezoneLayout))
+	body, statusCode, err := r.request(ctx, http.MethodDelete, "/items/ssbbot_notification_outbox", reqBody)
+	if err != nil {
+		return err
+	}
+	if statusCode != 200 && statusCode != 204 {
+		return fmt.Errorf("error pruning notification outbox in directus: %v", string(body))
+	}
+	return nil
+}
+
+func (r *DirectusRepository) GetUsersToRemind(ctx context.Context, issueCode string) ([]schemas.ChatSettings, error) {
+	reqBody := fmt.Appendf(nil, `{
+		"query": {
+			"filter": {
+				"_and": [
+					{"reminder_days": {"_gt": 0}},
+					{
+						"_or": [
+							{"latest_ssb_issue_reminded": {"_neq": %q}},
+							{"latest_ssb_issue_reminded": {"_null": true}}
+						]
+					},
+					{
+						"_or": [
+							{"unsubscribed_reason": {"_null": true}},
+							{"unsubscribed_reason": {"_empty": true}}
+						]
+					}
+				]
+			},
+			"limit": -1
+		}
+	}`, issueCode)
+	body, statusCode, err := r.request(ctx, "SEARCH", "/items/ssbbot_chat_settings", reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if statusCode != 200 {
+		return nil, fmt.Errorf("error searching for chats to remind in directus: %v", string(body))
+	}
+	var chatSettingsResponse map[string][]schemas.ChatSettings
+	if err := json.Unmarshal(body, &chatSettingsResponse); err != nil {
+		return nil, err
+	}
+	return chatSettingsResponse["data"], nil
+}
+
+func (r *DirectusRepository) GetUsersToNotifyAllotment(ctx context.Context, issueCode string) ([]schemas.ChatSettings, error) {
+	reqBody := fmt.Appendf(nil, `{
+		"query": {
+			"filter": {
+				"_and": [
+					{
+						"_or": [
+							{"latest_ssb_allotment_notified": {"_neq": %q}},
+							{"latest_ssb_allotment_notified": {"_null": true}}
+						]
+					},
+					{
+						"_or": [
+							{"unsubscribed_reason": {"_null": true}},
+							{"unsubscribed_reason": {"_empty": true}}
+						]
+					}
+				]
+			},
+			"limit": -1
+		}
+	}`, issueCode)
+	body, statusCode, err := r.request(ctx, "SEARCH", "/items/ssbbot_chat_settings", reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if statusCode != 200 {
+		return nil, fmt.Errorf("error searching for chats to send allotment results in directus: %v", string(body))
+	}
+	var chatSettingsResponse map[string][]schemas.ChatSettings
+	if err := json.Unmarshal(body, &chatSettingsResponse); err != nil {
+		return nil, err
+	}
+	return chatSettingsResponse["data"], nil
+}
+
+func (r *DirectusRepository) GetUsersToNotifyPayouts(ctx context.Context, date string) ([]schemas.ChatSettings, error) {
+	reqBody := fmt.Appendf(nil, `{
+		"query": {
+			"filter": {
+				"_and": [
+					{"payout_notifications": {"_eq": true}},
+					{
+						"_or": [
+							{"last_payout_notified": {"_neq": %q}},
+							{"last_payout_notified": {"_null": true}}
+						]
+					},
+					{
+						"_or": [
+							{"unsubscribed_reason": {"_null": true}},
+							{"unsubscribed_reason": {"_empty": true}}
+						]
+					}
+				]
+			},
+			"limit": -1
+		}
+	}`, date)
+	body, statusCode, err := r.request(ctx, "SEARCH", "/items/ssbbot_chat_settings", reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if statusCode != 200 {
+		return nil, fmt.Errorf("error searching for chats to notify of payouts in directus: %v", string(body))
+	}
+	var chatSettingsResponse map[string][]schemas.ChatSettings
+	if err := json.Unmarshal(body, &chatSettingsResponse); err != nil {
+		return nil, err
+	}
+	return chatSettingsResponse["data"], nil
+}
+
+func (r *DirectusRepository) CountSubscribers(ctx context.Context) (int, error) {
+	reqBody := []byte(`{
+		"query": {
+			"aggregate": {
+				"count": "*"
+			},
+			"filter": {
+				"_or": [
+					{"unsubscribed_reason": {"_null": true}},
+					{"unsubscribed_reason": {"_empty": true}}
+				]
+			}
+		}
+	}`)
+	body, statusCode, err := r.request(ctx, "SEARCH", "/items/ssbbot_chat_settings", reqBody)
+	if err != nil {
+		return 0, err
+	}
+	if statusCode != 200 {
+		return 0, fmt.Errorf("error counting subscribers in directus: %v", string(body))
+	}
+	// the count is returned as a string on some databases
+	var countResponse struct {
+		Data []struct {
+			Count json.Number `json:"count"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &countResponse); err != nil {
+		return 0, err
+	}
+	if len(countResponse.Data) == 0 {
+		return 0, nil
+	}
+	count, err := countResponse.Data[0].Count.Int64()
+	return int(count), err
+}
+
+func (r *DirectusRepository) Ping(ctx context.Context) error {
+	body, statusCode, err := r.request(ctx, http.MethodGet, "/server/ping", nil)
+	if err != nil {
+		return err
+	}
+	if statusCode != 200 {
+		return fmt.Errorf("status code %v pinging directus: %v", statusCode, string(body))
+	}
+	return nil
+}
+
+func (r *DirectusRepository) Close() error {
+	r.client.CloseIdleConnections()
+	return nil
+}
+
+func (r *DirectusRepository) GetHoldings(ctx context.Context, chatId int64) ([]schemas.Holding, error) {
+	reqBody := fmt.Appendf(nil, `{
+		"query": {
+			"filter": {
+				"chat_id": {
+					"_eq": "%v"
+				}
+			},
+			"sort": ["issue_code"],
+			"limit": -1
+		}
+	}`, chatId)
+	body, statusCode, err := r.request(ctx, "SEARCH", "/items/ssbbot_holdings", reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if statusCode != 200 {
+		return nil, fmt.Errorf("error getting holdings in directus: %v", string(body))
+	}
+	var holdingsResponse map[string][]schemas.Holding
+	if err := json.Unmarshal(body, &holdingsResponse); err != nil {
+		return nil, err
+	}
+	return holdingsResponse["data"], nil
+}
+
+// SaveHolding updates the amount of the holding by query, as holdings are
+// looked up by chat id and issue code rather than their directus primary key,
+// and creates the holding if there was nothing to update.
+func (r *DirectusRepository) SaveHolding(ctx context.Context, holding schemas.Holding) error {
+	reqBody := fmt.Appendf(nil, `{
+		"query": {
+			"filter": {
+				"chat_id": {
+					"_eq": "%v"
+				},
+				"issue_code": {
+					"_eq": %q
+				}
+			}
+		},
+		"data": {
+			"amount": %v
+		}
+	}`, holding.ChatId, holding.IssueCode, holding.Amount)
+	body, statusCode, err := r.request(ctx, http.MethodPatch, "/items/ssbbot_holdings", reqBody)
+	if err != nil {
+		return err
+	}
+	if statusCode != 200 && statusCode != 204 {
+		return fmt.Errorf("error updating holding in directus: %v", string(body))
+	}
+	var updatedResponse struct {
+		Data []json.RawMessage `json:"data"`
+	}
+	if statusCode == 200 {
+		if err := json.Unmarshal(body, &updatedResponse); err != nil {
+			return err
+		}
+	}
+	if len(updatedResponse.Data) > 0 {
+		return nil
+	}
+
+	reqBody, _ = json.Marshal(holding)
+	body, statusCode, err = r.request(ctx, http.MethodPost, "/items/ssbbot_holdings", reqBody)
+	if err != nil {
+		return err
+	}
+	if statusCode != 200 && statusCode != 204 {
+		return fmt.Errorf("error inserting holding to directus: %v", string(body))
+	}
+	return nil
+}
+
+func (r *DirectusRepository) DeleteHolding(ctx context.Context, chatId int64, issueCode string) error {
+	reqBody := fmt.Appendf(nil, `{
+		"query": {
+			"filter": {
+				"chat_id": {
+					"_eq": "%v"
+				},
+				"issue_code": {
+					"_eq": %q
+				}
+			}
+		}
+	}`, chatId, issueCode)
+	body, statusCode, err := r.request(ctx, http.MethodDelete, "/items/ssbbot_holdings", reqBody)
+	if err != nil {
+		return err
+	}
+	if statusCode != 200 && statusCode != 204 {
+		return fmt.Errorf("error deleting holding in directus: %v", string(body))
+	}
+	return nil
+}
+
+func (r *DirectusRepository) migrateHoldings(ctx context.Context, fromChatId int64, toChatId int64) error {
+	reqBody := fmt.Appendf(nil, `{
+		"query": {
+			"filter": {
+				"chat_id": {
+					"_eq": "%v"
+				}
+			}
+		},
+		"data": {
+			"chat_id": "%v"
+		}
+	}`, fromChatId, toChatId)
+	body, statusCode, err := r.request(ctx, http.MethodPatch, "/items/ssbbot_holdings", reqBody)
+	if err != nil {
+		return err
+	}
+	if statusCode != 200 && statusCode != 204 {
+		return fmt.Errorf("error migrating holdings in directus: %v", string(body))
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+)
+
+// MemoryRepository keeps everything in memory. Nothing is persisted, so it is
+// only meant for tests and local experiments.
+type MemoryRepository struct {
+	mu       sync.Mutex
+	chats    map[int64]schemas.ChatSettings
+	outbox   map[memoryOutboxKey]schemas.OutboxEntry
+	holdings map[memoryHoldingKey]schemas.Holding
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		chats:    make(map[int64]schemas.ChatSettings),
+		outbox:   make(map[memoryOutboxKey]schemas.OutboxEntry),
+		holdings: make(map[memoryHoldingKey]schemas.Holding),
+	}
+}
+
+func (r *MemoryRepository) GetChatSettings(ctx context.Context, chatId int64) (*schemas.ChatSettings, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	chatSettings, ok := r.chats[chatId]
+	if !ok {
+		return nil, nil
+	}
+	return &chatSettings, nil
+}
+
+func (r *MemoryRepository) CreateChatSettings(ctx context.Context, chatSettings schemas.ChatSettings) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.chats[chatSettings.ChatId]; ok {
+		return fmt.Errorf("chat settings for chat id %v already exists", chatSettings.ChatId)
+	}
+	r.chats[chatSettings.ChatId] = chatSettings
+	return nil
+}
+
+func (r *MemoryRepository) UpdateChatSettings(ctx context.Context, chatSettings schemas.ChatSettings) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.chats[chatSettings.ChatId]; !ok {
+		return fmt.Errorf("chat settings for chat id %v not found", chatSettings.ChatId)
+	}
+	r.chats[chatSettings.ChatId] = chatSettings
+	return nil
+}
+
+func (r *MemoryRepository) DeleteChatSettings(ctx context.Context, chatId int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.chats, chatId)
+	return nil
+}
+
+func (r *MemoryRepository) MigrateChatSettings(ctx context.Context, fromChatId int64, toChatId int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, holding := range r.holdings {
+		if key.chatId == fromChatId {
+			delete(r.holdings, key)
+			holding.ChatId = toChatId
+			r.holdings[memoryHoldingKey{toChatId, key.issueCode}] = holding
+		}
+	}
+	chatSettings, ok := r.chats[fromChatId]
+	if !ok {
+		return nil
+	}
+	delete(r.chats, fromChatId)
+	for key, entry := range r.outbox {
+		if key.chatId == fromChatId {
+			delete(r.outbox, key)
+			entry.ChatId = toChatId
+			r.outbox[memoryOutboxKey{key.issueCode, toChatId}] = entry
+		}
+	}
+	if _, ok := r.chats[toChatId]; ok {
+		return nil
+	}
+	chatSettings.ChatId = toChatId
+	r.chats[toChatId] = chatSettings
+	return nil
+}
+
+func (r *MemoryRepository) GetUsersToNotify(ctx context.Context, issueCode string) ([]schemas.ChatSettings, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var chats []schemas.ChatSettings
+	for _, chatSettings := range r.chats {
+		if chatSettings.LatestSSBIssueNotified != issueCode && chatSettings.UnsubscribedReason == "" {
+			chats = append(chats, chatSettings)
+		}
+	}
+	// map iteration order is random, keep results stable for tests
+	sort.Slice(chats, func(i, j int) bool { return chats[i].ChatId < chats[j].ChatId })
+	return chats, nil
+}
+
+func (r *MemoryRepository) GetUsersToRemind(ctx context.Context, issueCode string) ([]schemas.ChatSettings, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var chats []schemas.ChatSettings
+	for _, chatSettings := range r.chats {
+		if chatSettings.ReminderDays > 0 && chatSettings.LatestSSBIssueReminded != issueCode && chatSettings.UnsubscribedReason == "" {
+			chats = append(chats, chatSettings)
+		}
+	}
+	sort.Slice(chats, func(i, j int) bool { return chats[i].ChatId < chats[j].ChatId })
+	return chats, nil
+}
+
+func (r *MemoryRepository) GetUsersToNotifyAllotment(ctx context.Context, issueCode string) ([]schemas.ChatSettings, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var chats []schemas.ChatSettings
+	for _, chatSettings := range r.chats {
+		if chatSettings.LatestSSBAllotmentNotified != issueCode && chatSettings.UnsubscribedReason == "" {
+			chats = append(chats, chatSettings)
+		}
+	}
+	sort.Slice(chats, func(i, j int) bool { return chats[i].ChatId < chats[j].ChatId })
+	return chats, nil
+}
+
+func (r *MemoryRepository) GetUsersToNotifyPayouts(ctx context.Context, date string) ([]schemas.ChatSettings, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var chats []schemas.ChatSettings
+	for _, chatSettings := range r.chats {
+		if chatSettings.PayoutNotifications && chatSettings.LastPayoutNotified != date && chatSettings.UnsubscribedReason == "" {
+			chats = append(chats, chatSettings)
+		}
+	}
+	sort.Slice(chats, func(i, j int) bool { return chats[i].ChatId < chats[j].ChatId })
+	return chats, nil
+}
+
+func (r *MemoryRepository) CountSubscribers(ctx context.Context) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := 0
+	for _, chatSettings := range r.chats {
+		if chatSettings.UnsubscribedReason == "" {
+			count++
+		}
+	}
+	return count, nil
+}
+
+type memoryOutboxKey struct {
+	issueCode string
+	chatId    int64
+}
+
+func (r *MemoryRepository) EnqueueNotifications(ctx context.Context, issueCode string, chatIds []int64, enqueuedTime time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, chatId := range chatIds {
+		key := memoryOutboxKey{issueCode, chatId}
+		if _, ok := r.outbox[key]; !ok {
+			r.outbox[key] = schemas.OutboxEntry{
+				IssueCode:   issueCode,
+				ChatId:      chatId,
+				Status:      schemas.OutboxStatusPending,
+				UpdatedTime: schemas.DatetimeWithoutTimezone(enqueuedTime),
+			}
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) GetNotifications(ctx context.Context, issueCode string) ([]schemas.OutboxEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var entries []schemas.OutboxEntry
+	for key, entry := range r.outbox {
+		if key.issueCode == issueCode {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ChatId < entries[j].ChatId })
+	return entries, nil
+}
+
+func (r *MemoryRepository) UpdateNotification(ctx context.Context, entry schemas.OutboxEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := memoryOutboxKey{entry.IssueCode, entry.ChatId}
+	if _, ok := r.outbox[key]; !ok {
+		return fmt.Errorf("outbox entry for %v to chat id %v not found", entry.IssueCode, entry.ChatId)
+	}
+	r.outbox[key] = entry
+	return nil
+}
+
+func (r *MemoryRepository) PruneNotifications(ctx context.Context, before time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, entry := range r.outbox {
+		if time.Time(entry.UpdatedTime).Before(before) {
+			delete(r.outbox, key)
+		}
+	}
+	return nil
+}
+
+type memoryHoldingKey struct {
+	chatId    int64
+	issueCode string
+}
+
+func (r *MemoryRepository) GetHoldings(ctx context.Context, chatId int64) ([]schemas.Holding, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var holdings []schemas.Holding
+	for key, holding := range r.holdings {
+		if key.chatId == chatId {
+			holdings = append(holdings, holding)
+		}
+	}
+	sort.Slice(holdings, func(i, j int) bool { return holdings[i].IssueCode < holdings[j].IssueCode })
+	return holdings, nil
+}
+
+func (r *MemoryRepository) SaveHolding(ctx context.Context, holding schemas.Holding) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.holdings[memoryHoldingKey{holding.ChatId, holding.IssueCode}] = holding
+	return nil
+}
+
+func (r *MemoryRepository) DeleteHolding(ctx context.Context, chatId int64, issueCode string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.holdings, memoryHoldingKey{chatId, issueCode})
+	return nil
+}
+
+func (r *MemoryRepository) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (r *MemoryRepository) Close() error {
+	return nil
+}
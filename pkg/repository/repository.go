@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/utils"
+)
+
+// ChatSettingsRepository persists the ChatSettings of every subscribed chat.
+type ChatSettingsRepository interface {
+	// GetChatSettings returns nil without an error if the chat is not subscribed.
+	GetChatSettings(ctx context.Context, chatId int64) (*schemas.ChatSettings, error)
+	CreateChatSettings(ctx context.Context, chatSettings schemas.ChatSettings) error
+	UpdateChatSettings(ctx context.Context, chatSettings schemas.ChatSettings) error
+	DeleteChatSettings(ctx context.Context, chatId int64) error
+	// GetUsersToNotify returns the subscribed chats that have not been notified
+	// of issueCode, leaving out chats with an UnsubscribedReason.
+	GetUsersToNotify(ctx context.Context, issueCode string) ([]schemas.ChatSettings, error)
+	// GetUsersToRemind returns the subscribed chats with ReminderDays set that
+	// have not been reminded of issueCode.
+	GetUsersToRemind(ctx context.Context, issueCode string) ([]schemas.ChatSettings, error)
+	// GetUsersToNotifyAllotment returns the subscribed chats that have not
+	// been sent the allotment results of issueCode.
+	GetUsersToNotifyAllotment(ctx context.Context, issueCode string) ([]schemas.ChatSettings, error)
+	// GetUsersToNotifyPayouts returns the subscribed chats with
+	// PayoutNotifications set that have not been checked for coupon payments
+	// on date, formatted as time.DateOnly.
+	GetUsersToNotifyPayouts(ctx context.Context, date string) ([]schemas.ChatSettings, error)
+	// CountSubscribers returns the number of chats without an UnsubscribedReason.
+	CountSubscribers(ctx context.Context) (int, error)
+	// MigrateChatSettings moves the settings, and everything else kept per
+	// chat, of a group that was upgraded to a supergroup to its new chat id.
+	// It does nothing if fromChatId has nothing stored, so it is safe to call
+	// for both migration service messages.
+	MigrateChatSettings(ctx context.Context, fromChatId int64, toChatId int64) error
+}
+
+// OutboxRepository records the delivery of every issue's notification to every
+// chat, so an interrupted broadcast resumes where it stopped.
+type OutboxRepository interface {
+	// EnqueueNotifications adds a pending entry updated at enqueuedTime for
+	// every chat that does not have an entry for issueCode yet.
+	EnqueueNotifications(ctx context.Context, issueCode string, chatIds []int64, enqueuedTime time.Time) error
+	GetNotifications(ctx context.Context, issueCode string) ([]schemas.OutboxEntry, error)
+	UpdateNotification(ctx context.Context, entry schemas.OutboxEntry) error
+	// PruneNotifications deletes entries last updated before the given time.
+	PruneNotifications(ctx context.Context, before time.Time) error
+}
+
+// HoldingsRepository persists the savings bonds every chat holds, at most one
+// Holding per chat and issue.
+type HoldingsRepository interface {
+	// GetHoldings returns the holdings of a chat ordered by issue code.
+	GetHoldings(ctx context.Context, chatId int64) ([]schemas.Holding, error)
+	// SaveHolding creates the holding, or replaces the amount of an existing
+	// holding of the same issue.
+	SaveHolding(ctx context.Context, holding schemas.Holding) error
+	DeleteHolding(ctx context.Context, chatId int64, issueCode string) error
+}
+
+// Repository is everything the bot persists, kept in a single backend.
+type Repository interface {
+	ChatSettingsRepository
+	OutboxRepository
+	HoldingsRepository
+	// Ping checks that the backend can be reached.
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// NewRepository returns the repository for the given backend, either
+// "directus", "sqlite" or "memory".
+func NewRepository(backend string) (Repository, error) {
+	switch backend {
+	case utils.STORAGE_BACKEND_DIRECTUS:
+		return NewDirectusRepository(utils.DirectusHost, utils.DirectusToken), nil
+	case utils.STORAGE_BACKEND_SQLITE:
+		return NewSQLiteRepository(utils.SQLitePath)
+	case utils.STORAGE_BACKEND_MEMORY:
+		return NewMemoryRepository(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %v", backend)
+	}
+}
+
+func InsertChatSettingsIfNotPresent(ctx context.Context, repo ChatSettingsRepository, chatId int64) (*schemas.ChatSettings, bool, error) {
+	chatSettings, err := repo.GetChatSettings(ctx, chatId)
+	if err != nil {
+		return nil, false, err
+	}
+	if chatSettings == nil {
+		localTimezone, err := time.LoadLocation(utils.DEFAULT_TIMEZONE) // Look up a location by it's IANA name.
+		if err != nil {
+			panic(err)
+		}
+		chatSettings = &schemas.ChatSettings{
+			ChatId:               chatId,
+			LastNotificationTime: schemas.DatetimeWithoutTimezone(time.Now().In(localTimezone)),
+		}
+		err = repo.CreateChatSettings(ctx, *chatSettings)
+		if err != nil {
+			return nil, false, err
+		}
+
+		return chatSettings, false, nil
+	}
+	return chatSettings, true, nil
+}
+
+// MarkChatUnsubscribed stops notifying a chat the bot can no longer reach,
+// keeping its settings in case it subscribes again.
+func MarkChatUnsubscribed(ctx context.Context, repo ChatSettingsRepository, chatId int64, reason string) error {
+	chatSettings, err := repo.GetChatSettings(ctx, chatId)
+	if err != nil || chatSettings == nil {
+		return err
+	}
+	chatSettings.UnsubscribedReason = reason
+	return repo.UpdateChatSettings(ctx, *chatSettings)
+}
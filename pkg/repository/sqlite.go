@@ -0,0 +1,355 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+	log "github.com/sirupsen/logrus"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteMigrations are applied in order on startup. The index of the last
+// applied migration plus one is stored in the database's user_version, so new
+// migrations must only ever be appended.
+var sqliteMigrations = []string{
+	`CREATE TABLE ssbbot_chat_settings (
+		chat_id INTEGER PRIMARY KEY,
+		last_notification_time TEXT NOT NULL,
+		latest_ssb_month_notified INTEGER NOT NULL DEFAULT 0
+	)`,
+	`ALTER TABLE ssbbot_chat_settings ADD COLUMN latest_ssb_issue_notified TEXT NOT NULL DEFAULT '';
+	ALTER TABLE ssbbot_chat_settings DROP COLUMN latest_ssb_month_notified`,
+	`ALTER TABLE ssbbot_chat_settings ADD COLUMN unsubscribed_reason TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE ssbbot_notification_outbox (
+		issue_code TEXT NOT NULL,
+		chat_id INTEGER NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		updated_time TEXT NOT NULL,
+		PRIMARY KEY (issue_code, chat_id)
+	)`,
+	`ALTER TABLE ssbbot_chat_settings ADD COLUMN reminder_days INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE ssbbot_chat_settings ADD COLUMN latest_ssb_issue_reminded TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE ssbbot_chat_settings ADD COLUMN latest_ssb_allotment_notified TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE ssbbot_holdings (
+		chat_id INTEGER NOT NULL,
+		issue_code TEXT NOT NULL,
+		amount INTEGER NOT NULL,
+		PRIMARY KEY (chat_id, issue_code)
+	)`,
+	`ALTER TABLE ssbbot_chat_settings ADD COLUMN payout_notifications INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE ssbbot_chat_settings ADD COLUMN last_payout_notified TEXT NOT NULL DEFAULT ''`,
+}
+
+// SQLiteRepository stores everything in an embedded sqlite database, for
+// deployments without a directus instance.
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteRepository(path string) (*SQLiteRepository, error) {
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%v?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)", path))
+	if err != nil {
+		return nil, err
+	}
+	// sqlite only allows a single writer
+	db.SetMaxOpenConns(1)
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteRepository{db: db}, nil
+}
+
+func migrateSQLite(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	for i := version; i < len(sqliteMigrations); i++ {
+		log.Infof("applying sqlite migration %v", i+1)
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error applying sqlite migration %v: %w", i+1, err)
+		}
+		// PRAGMA does not support placeholders
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+func (r *SQLiteRepository) Close() error {
+	return r.db.Close()
+}
+
+// sqliteChatSettingsColumns are the columns of ssbbot_chat_settings in the
+// order scanSQLiteChatSettings and sqliteChatSettingsValues expect them.
+const sqliteChatSettingsColumns = `chat_id, last_notification_time, latest_ssb_issue_notified, unsubscribed_reason,
+	reminder_days, latest_ssb_issue_reminded, latest_ssb_allotment_notified, payout_notifications, last_payout_notified`
+
+type sqliteScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSQLiteChatSettings(row sqliteScanner) (*schemas.ChatSettings, error) {
+	var chatSettings schemas.ChatSettings
+	var lastNotificationTime string
+	if err := row.Scan(&chatSettings.ChatId, &lastNotificationTime, &chatSettings.LatestSSBIssueNotified, &chatSettings.UnsubscribedReason,
+		&chatSettings.ReminderDays, &chatSettings.LatestSSBIssueReminded, &chatSettings.LatestSSBAllotmentNotified,
+		&chatSettings.PayoutNotifications, &chatSettings.LastPayoutNotified); err != nil {
+		return nil, err
+	}
+	parsedTime, err := time.Parse(schemas.DatetimeWithoutTimezoneLayout, lastNotificationTime)
+	if err != nil {
+		return nil, err
+	}
+	chatSettings.LastNotificationTime = schemas.DatetimeWithoutTimezone(parsedTime)
+	return &chatSettings, nil
+}
+
+func sqliteChatSettingsValues(chatSettings schemas.ChatSettings) []any {
+	return []any{
+		chatSettings.ChatId,
+		time.Time(chatSettings.LastNotificationTime).Format(schemas.DatetimeWithoutTimezoneLayout),
+		chatSettings.LatestSSBIssueNotified,
+		chatSettings.UnsubscribedReason,
+		chatSettings.ReminderDays,
+		chatSettings.LatestSSBIssueReminded,
+		chatSettings.LatestSSBAllotmentNotified,
+		chatSettings.PayoutNotifications,
+		chatSettings.LastPayoutNotified,
+	}
+}
+
+// queryChatSettings returns the chat settings matching the where clause.
+func (r *SQLiteRepository) queryChatSettings(ctx context.Context, where string, args ...any) ([]schemas.ChatSettings, error) {
+	rows, err := r.db.QueryContext(ctx, fmt.Sprintf(`SELECT %v FROM ssbbot_chat_settings WHERE %v`, sqliteChatSettingsColumns, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var chats []schemas.ChatSettings
+	for rows.Next() {
+		chatSettings, err := scanSQLiteChatSettings(rows)
+		if err != nil {
+			return nil, err
+		}
+		chats = append(chats, *chatSettings)
+	}
+	return chats, rows.Err()
+}
+
+func (r *SQLiteRepository) GetChatSettings(ctx context.Context, chatId int64) (*schemas.ChatSettings, error) {
+	row := r.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT %v FROM ssbbot_chat_settings WHERE chat_id = ?`, sqliteChatSettingsColumns), chatId)
+	chatSettings, err := scanSQLiteChatSettings(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return chatSettings, err
+}
+
+func (r *SQLiteRepository) CreateChatSettings(ctx context.Context, chatSettings schemas.ChatSettings) error {
+	_, err := r.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO ssbbot_chat_settings (%v) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, sqliteChatSettingsColumns),
+		sqliteChatSettingsValues(chatSettings)...)
+	if err != nil {
+		return fmt.Errorf("error inserting chat settings to sqlite: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) UpdateChatSettings(ctx context.Context, chatSettings schemas.ChatSettings) error {
+	values := sqliteChatSettingsValues(chatSettings)
+	res, err := r.db.ExecContext(ctx, `UPDATE ssbbot_chat_settings
+		SET last_notification_time = ?, latest_ssb_issue_notified = ?, unsubscribed_reason = ?,
+			reminder_days = ?, latest_ssb_issue_reminded = ?, latest_ssb_allotment_notified = ?, payout_notifications = ?, last_payout_notified = ?
+		WHERE chat_id = ?`,
+		append(values[1:], chatSettings.ChatId)...,
+	)
+	if err != nil {
+		return fmt.Errorf("error updating chat settings to sqlite: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("error updating chat settings to sqlite: chat id %v not found", chatSettings.ChatId)
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) DeleteChatSettings(ctx context.Context, chatId int64) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM ssbbot_chat_settings WHERE chat_id = ?`, chatId); err != nil {
+		return fmt.Errorf("error deleting chat settings in sqlite: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) GetUsersToNotify(ctx context.Context, issueCode string) ([]schemas.ChatSettings, error) {
+	return r.queryChatSettings(ctx, `latest_ssb_issue_notified != ? AND unsubscribed_reason = ''`, issueCode)
+}
+
+func (r *SQLiteRepository) GetUsersToRemind(ctx context.Context, issueCode string) ([]schemas.ChatSettings, error) {
+	return r.queryChatSettings(ctx, `reminder_days > 0 AND latest_ssb_issue_reminded != ? AND unsubscribed_reason = ''`, issueCode)
+}
+
+func (r *SQLiteRepository) GetUsersToNotifyAllotment(ctx context.Context, issueCode string) ([]schemas.ChatSettings, error) {
+	return r.queryChatSettings(ctx, `latest_ssb_allotment_notified != ? AND unsubscribed_reason = ''`, issueCode)
+}
+
+func (r *SQLiteRepository) GetUsersToNotifyPayouts(ctx context.Context, date string) ([]schemas.ChatSettings, error) {
+	return r.queryChatSettings(ctx, `payout_notifications AND last_payout_notified != ? AND unsubscribed_reason = ''`, date)
+}
+
+func (r *SQLiteRepository) CountSubscribers(ctx context.Context) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM ssbbot_chat_settings WHERE unsubscribed_reason = ''`).Scan(&count)
+	return count, err
+}
+
+func (r *SQLiteRepository) MigrateChatSettings(ctx context.Context, fromChatId int64, toChatId int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM ssbbot_chat_settings WHERE chat_id = ?)`, toChatId).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		_, err = tx.ExecContext(ctx, `DELETE FROM ssbbot_chat_settings WHERE chat_id = ?`, fromChatId)
+	} else {
+		_, err = tx.ExecContext(ctx, `UPDATE ssbbot_chat_settings SET chat_id = ? WHERE chat_id = ?`, toChatId, fromChatId)
+	}
+	if err != nil {
+		return fmt.Errorf("error migrating chat settings in sqlite: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE OR REPLACE ssbbot_notification_outbox SET chat_id = ? WHERE chat_id = ?`, toChatId, fromChatId); err != nil {
+		return fmt.Errorf("error migrating notification outbox in sqlite: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE OR REPLACE ssbbot_holdings SET chat_id = ? WHERE chat_id = ?`, toChatId, fromChatId); err != nil {
+		return fmt.Errorf("error migrating holdings in sqlite: %w", err)
+	}
+	return tx.Commit()
+}
+
+func (r *SQLiteRepository) EnqueueNotifications(ctx context.Context, issueCode string, chatIds []int64, enqueuedTime time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	updatedTime := enqueuedTime.Format(schemas.DatetimeWithoutTimezoneLayout)
+	for _, chatId := range chatIds {
+		_, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO ssbbot_notification_outbox (issue_code, chat_id, status, updated_time)
+			VALUES (?, ?, ?, ?)`, issueCode, chatId, schemas.OutboxStatusPending, updatedTime)
+		if err != nil {
+			return fmt.Errorf("error enqueueing notifications in sqlite: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *SQLiteRepository) GetNotifications(ctx context.Context, issueCode string) ([]schemas.OutboxEntry, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT issue_code, chat_id, status, attempts, last_error, updated_time
+		FROM ssbbot_notification_outbox WHERE issue_code = ? ORDER BY chat_id`, issueCode)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []schemas.OutboxEntry
+	for rows.Next() {
+		var entry schemas.OutboxEntry
+		var updatedTime string
+		if err := rows.Scan(&entry.IssueCode, &entry.ChatId, &entry.Status, &entry.Attempts, &entry.LastError, &updatedTime); err != nil {
+			return nil, err
+		}
+		parsedTime, err := time.Parse(schemas.DatetimeWithoutTimezoneLayout, updatedTime)
+		if err != nil {
+			return nil, err
+		}
+		entry.UpdatedTime = schemas.DatetimeWithoutTimezone(parsedTime)
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (r *SQLiteRepository) UpdateNotification(ctx context.Context, entry schemas.OutboxEntry) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE ssbbot_notification_outbox
+		SET status = ?, attempts = ?, last_error = ?, updated_time = ?
+		WHERE issue_code = ? AND chat_id = ?`,
+		entry.Status,
+		entry.Attempts,
+		entry.LastError,
+		time.Time(entry.UpdatedTime).Format(schemas.DatetimeWithoutTimezoneLayout),
+		entry.IssueCode,
+		entry.ChatId,
+	)
+	if err != nil {
+		return fmt.Errorf("error updating notification outbox in sqlite: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("outbox entry for %v to chat id %v not found", entry.IssueCode, entry.ChatId)
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) PruneNotifications(ctx context.Context, before time.Time) error {
+	// the layout sorts lexicographically in time order
+	_, err := r.db.ExecContext(ctx, `DELETE FROM ssbbot_notification_outbox WHERE updated_time < ?`, before.Format(schemas.DatetimeWithoutTimezoneLayout))
+	if err != nil {
+		return fmt.Errorf("error pruning notification outbox in sqlite: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) GetHoldings(ctx context.Context, chatId int64) ([]schemas.Holding, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT chat_id, issue_code, amount FROM ssbbot_holdings WHERE chat_id = ? ORDER BY issue_code`, chatId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var holdings []schemas.Holding
+	for rows.Next() {
+		var holding schemas.Holding
+		if err := rows.Scan(&holding.ChatId, &holding.IssueCode, &holding.Amount); err != nil {
+			return nil, err
+		}
+		holdings = append(holdings, holding)
+	}
+	return holdings, rows.Err()
+}
+
+func (r *SQLiteRepository) SaveHolding(ctx context.Context, holding schemas.Holding) error {
+	_, err := r.db.ExecContext(ctx, `INSERT INTO ssbbot_holdings (chat_id, issue_code, amount) VALUES (?, ?, ?)
+		ON CONFLICT (chat_id, issue_code) DO UPDATE SET amount = excluded.amount`,
+		holding.ChatId, holding.IssueCode, holding.Amount)
+	if err != nil {
+		return fmt.Errorf("error saving holding to sqlite: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) DeleteHolding(ctx context.Context, chatId int64, issueCode string) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM ssbbot_holdings WHERE chat_id = ? AND issue_code = ?`, chatId, issueCode); err != nil {
+		return fmt.Errorf("error deleting holding in sqlite: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+)
+
+// wallClock is a time as stored without a timezone, to the second.
+var wallClock = time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)
+
+func newTestSQLiteRepository(t *testing.T, path string) *SQLiteRepository {
+	t.Helper()
+	repo, err := NewSQLiteRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func userVersion(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	return version
+}
+
+func TestSQLiteMigrationsAreIdempotent(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "ssbbot.db")
+	repo, err := NewSQLiteRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CreateChatSettings(ctx, schemas.ChatSettings{ChatId: 1, LastNotificationTime: schemas.DatetimeWithoutTimezone(wallClock)}); err != nil {
+		t.Fatal(err)
+	}
+	repo.Close()
+
+	repo = newTestSQLiteRepository(t, path)
+	if version := userVersion(t, repo.db); version != len(sqliteMigrations) {
+		t.Errorf("user_version is %v after reopening, want %v", version, len(sqliteMigrations))
+	}
+	chatSettings, err := repo.GetChatSettings(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chatSettings == nil {
+		t.Error("chat settings were lost on reopening")
+	}
+}
+
+func TestSQLiteMigratesFromFirstVersion(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "ssbbot.db")
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%v", path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a database created by the first release
+	for _, statement := range []string{
+		sqliteMigrations[0],
+		`PRAGMA user_version = 1`,
+		`INSERT INTO ssbbot_chat_settings (chat_id, last_notification_time, latest_ssb_month_notified) VALUES (1, '2026-10-01T09:00:00', 10)`,
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	repo := newTestSQLiteRepository(t, path)
+	if version := userVersion(t, repo.db); version != len(sqliteMigrations) {
+		t.Errorf("user_version is %v, want %v", version, len(sqliteMigrations))
+	}
+	chatSettings, err := repo.GetChatSettings(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &schemas.ChatSettings{ChatId: 1, LastNotificationTime: schemas.DatetimeWithoutTimezone(time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC))}
+	if !reflect.DeepEqual(chatSettings, want) {
+		t.Errorf("migrated chat settings are %+v, want %+v", chatSettings, want)
+	}
+}
+
+func TestSQLiteChatSettings(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestSQLiteRepository(t, filepath.Join(t.TempDir(), "ssbbot.db"))
+	chatSettings := schemas.ChatSettings{
+		ChatId:                     -100123,
+		LastNotificationTime:       schemas.DatetimeWithoutTimezone(wallClock),
+		LatestSSBIssueNotified:     "SBNOV26",
+		ReminderDays:               3,
+		LatestSSBIssueReminded:     "SBOCT26",
+		LatestSSBAllotmentNotified: "SBSEP26",
+		PayoutNotifications:        true,
+		LastPayoutNotified:         "2026-10-17",
+	}
+	if err := repo.CreateChatSettings(ctx, chatSettings); err != nil {
+		t.Fatal(err)
+	}
+	got, err := repo.GetChatSettings(ctx, chatSettings.ChatId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*got, chatSettings) {
+		t.Errorf("read back %+v, want %+v", *got, chatSettings)
+	}
+
+	chatSettings.UnsubscribedReason = "bot blocked"
+	if err := repo.UpdateChatSettings(ctx, chatSettings); err != nil {
+		t.Fatal(err)
+	}
+	got, err = repo.GetChatSettings(ctx, chatSettings.ChatId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*got, chatSettings) {
+		t.Errorf("read back %+v after updating, want %+v", *got, chatSettings)
+	}
+	chats, err := repo.GetUsersToNotify(ctx, "SBDEC26")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chats) != 0 {
+		t.Errorf("unsubscribed chat is to be notified")
+	}
+
+	if err := repo.UpdateChatSettings(ctx, schemas.ChatSettings{ChatId: 404}); err == nil {
+		t.Error("expected an error updating a missing chat")
+	}
+	if err := repo.DeleteChatSettings(ctx, chatSettings.ChatId); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := repo.GetChatSettings(ctx, chatSettings.ChatId); err != nil || got != nil {
+		t.Errorf("read back %+v, %v after deleting, want nothing", got, err)
+	}
+}
+
+func TestSQLiteOutbox(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestSQLiteRepository(t, filepath.Join(t.TempDir(), "ssbbot.db"))
+	if err := repo.EnqueueNotifications(ctx, "SBNOV26", []int64{2, 1}, wallClock); err != nil {
+		t.Fatal(err)
+	}
+	sent := schemas.OutboxEntry{
+		IssueCode:   "SBNOV26",
+		ChatId:      1,
+		Status:      schemas.OutboxStatusSent,
+		Attempts:    1,
+		UpdatedTime: schemas.DatetimeWithoutTimezone(wallClock.Add(time.Minute)),
+	}
+	if err := repo.UpdateNotification(ctx, sent); err != nil {
+		t.Fatal(err)
+	}
+	// enqueueing again leaves existing entries as they are
+	if err := repo.EnqueueNotifications(ctx, "SBNOV26", []int64{1, 2, 3}, wallClock.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := repo.GetNotifications(ctx, "SBNOV26")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := func(chatId int64, enqueuedTime time.Time) schemas.OutboxEntry {
+		return schemas.OutboxEntry{IssueCode: "SBNOV26", ChatId: chatId, Status: schemas.OutboxStatusPending, UpdatedTime: schemas.DatetimeWithoutTimezone(enqueuedTime)}
+	}
+	want := []schemas.OutboxEntry{sent, pending(2, wallClock), pending(3, wallClock.Add(time.Hour))}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("outbox is %+v, want %+v", entries, want)
+	}
+
+	if err := repo.UpdateNotification(ctx, schemas.OutboxEntry{IssueCode: "SBNOV26", ChatId: 404}); err == nil {
+		t.Error("expected an error updating a missing entry")
+	}
+	if err := repo.PruneNotifications(ctx, wallClock.Add(30*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	entries, err = repo.GetNotifications(ctx, "SBNOV26")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ChatId != 3 {
+		t.Errorf("outbox after pruning is %+v, want only chat 3's entry", entries)
+	}
+}
+
+func TestSQLiteHoldings(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestSQLiteRepository(t, filepath.Join(t.TempDir(), "ssbbot.db"))
+	for _, holding := range []schemas.Holding{
+		{ChatId: 1, IssueCode: "SBNOV26", Amount: 5000},
+		{ChatId: 1, IssueCode: "SBJAN26", Amount: 1000},
+		{ChatId: 1, IssueCode: "SBNOV26", Amount: 7500},
+		{ChatId: 2, IssueCode: "SBNOV26", Amount: 500},
+	} {
+		if err := repo.SaveHolding(ctx, holding); err != nil {
+			t.Fatal(err)
+		}
+	}
+	holdings, err := repo.GetHoldings(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []schemas.Holding{{ChatId: 1, IssueCode: "SBJAN26", Amount: 1000}, {ChatId: 1, IssueCode: "SBNOV26", Amount: 7500}}
+	if !reflect.DeepEqual(holdings, want) {
+		t.Errorf("holdings are %+v, want %+v", holdings, want)
+	}
+
+	if err := repo.DeleteHolding(ctx, 1, "SBJAN26"); err != nil {
+		t.Fatal(err)
+	}
+	holdings, err = repo.GetHoldings(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(holdings) != 1 || holdings[0].IssueCode != "SBNOV26" {
+		t.Errorf("holdings after deleting are %+v, want only SBNOV26", holdings)
+	}
+}
+
+func TestSQLiteMigrateChatSettings(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestSQLiteRepository(t, filepath.Join(t.TempDir(), "ssbbot.db"))
+	const group, supergroup = -5, -1005
+	for _, chatId := range []int64{group, supergroup} {
+		if err := repo.CreateChatSettings(ctx, schemas.ChatSettings{ChatId: chatId, LastNotificationTime: schemas.DatetimeWithoutTimezone(wallClock)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.SaveHolding(ctx, schemas.Holding{ChatId: chatId, IssueCode: "SBNOV26", Amount: 500}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.SaveHolding(ctx, schemas.Holding{ChatId: group, IssueCode: "SBJAN26", Amount: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	// both chats have an entry for SBNOV26, which must not fail the migration
+	if err := repo.EnqueueNotifications(ctx, "SBNOV26", []int64{group, supergroup}, wallClock); err != nil {
+		t.Fatal(err)
+	}
+
+	// migrating twice, as each of the two service messages does
+	for range 2 {
+		if err := repo.MigrateChatSettings(ctx, group, supergroup); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if chatSettings, err := repo.GetChatSettings(ctx, group); err != nil || chatSettings != nil {
+		t.Errorf("group settings are %+v, %v after migrating, want none", chatSettings, err)
+	}
+	if chatSettings, err := repo.GetChatSettings(ctx, supergroup); err != nil || chatSettings == nil {
+		t.Errorf("supergroup settings are %+v, %v after migrating", chatSettings, err)
+	}
+	holdings, err := repo.GetHoldings(ctx, supergroup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(holdings) != 2 {
+		t.Errorf("supergroup holdings are %+v, want SBJAN26 and SBNOV26", holdings)
+	}
+	entries, err := repo.GetNotifications(ctx, "SBNOV26")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ChatId != supergroup {
+		t.Errorf("outbox is %+v, want a single entry of the supergroup", entries)
+	}
+}
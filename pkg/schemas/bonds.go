@@ -1,12 +1,32 @@
 package schemas
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// BondTenorYears is how many years a savings bond pays interest for.
+const BondTenorYears = 10
 
 type BondDate time.Time
 
+// Custom marshal function for time, the inverse of UnmarshalJSON
+func (t BondDate) MarshalJSON() ([]byte, error) {
+	if time.Time(t).IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(time.Time(t).Format(time.DateOnly))
+}
+
 // Custom unmarshal function for time
 func (t *BondDate) UnmarshalJSON(data []byte) error {
 	str := string(data)
+	if str == "null" {
+		// dates such as tender results are null until they are published
+		*t = BondDate{}
+		return nil
+	}
 	// Remove the surrounding quotes if present
 	str = str[1 : len(str)-1]
 
@@ -45,6 +65,67 @@ type BondInterest struct {
 	Year10Return float64 `json:"year10_return"`
 }
 
+// Coupons returns the coupon rate of each year of the bond, in percent.
+func (b BondInterest) Coupons() []float64 {
+	return []float64{
+		b.Year1Coupon, b.Year2Coupon, b.Year3Coupon, b.Year4Coupon, b.Year5Coupon,
+		b.Year6Coupon, b.Year7Coupon, b.Year8Coupon, b.Year9Coupon, b.Year10Coupon,
+	}
+}
+
+// Returns returns the average return per year of the bond held to the end of
+// each of its years, in percent.
+func (b BondInterest) Returns() []float64 {
+	return []float64{
+		b.Year1Return, b.Year2Return, b.Year3Return, b.Year4Return, b.Year5Return,
+		b.Year6Return, b.Year7Return, b.Year8Return, b.Year9Return, b.Year10Return,
+	}
+}
+
+// CouponAt returns the coupon rate of the given year of the bond, from 1 to
+// BondTenorYears, in percent, or 0 for a year outside the tenor.
+func (b BondInterest) CouponAt(year int) float64 {
+	if year < 1 || year > BondTenorYears {
+		return 0
+	}
+	return b.Coupons()[year-1]
+}
+
+// ReturnAt returns the average return per year of the bond held to the end of
+// the given year, from 1 to BondTenorYears, in percent, or 0 for a year
+// outside the tenor.
+func (b BondInterest) ReturnAt(year int) float64 {
+	if year < 1 || year > BondTenorYears {
+		return 0
+	}
+	return b.Returns()[year-1]
+}
+
+// Validate checks that the bond pays interest from its first year, and that
+// neither the coupon nor the average return goes down from one year to the
+// next as savings bonds step up.
+func (b BondInterest) Validate() error {
+	if b.Year1Coupon <= 0 {
+		return fmt.Errorf("savings bonds %v has no year 1 coupon", b.IssueCode)
+	}
+	coupons, returns := b.Coupons(), b.Returns()
+	for i := range BondTenorYears {
+		if coupons[i] < 0 || returns[i] < 0 {
+			return fmt.Errorf("savings bonds %v has a negative rate in year %v", b.IssueCode, i+1)
+		}
+		if i == 0 {
+			continue
+		}
+		if coupons[i] < coupons[i-1] {
+			return fmt.Errorf("savings bonds %v coupon steps down from %.2f%% to %.2f%% in year %v", b.IssueCode, coupons[i-1], coupons[i], i+1)
+		}
+		if returns[i] < returns[i-1] {
+			return fmt.Errorf("savings bonds %v average return steps down from %.2f%% to %.2f%% in year %v", b.IssueCode, returns[i-1], returns[i], i+1)
+		}
+	}
+	return nil
+}
+
 type ListSavingsBondsInterestResultResponse struct {
 	Total   int            `json:"total"`
 	Records []BondInterest `json:"records"`
@@ -0,0 +1,25 @@
+package schemas_test
+
+import (
+	"testing"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/schemas"
+)
+
+func TestCouponAndReturnAtOutsideTenor(t *testing.T) {
+	interest := schemas.BondInterest{Year1Coupon: 2.5, Year1Return: 2.5, Year10Coupon: 3.1, Year10Return: 2.8}
+	if coupon := interest.CouponAt(1); coupon != 2.5 {
+		t.Errorf("year 1 coupon is %v, want 2.5", coupon)
+	}
+	if averageReturn := interest.ReturnAt(schemas.BondTenorYears); averageReturn != 2.8 {
+		t.Errorf("year %v return is %v, want 2.8", schemas.BondTenorYears, averageReturn)
+	}
+	for _, year := range []int{-1, 0, schemas.BondTenorYears + 1} {
+		if coupon := interest.CouponAt(year); coupon != 0 {
+			t.Errorf("year %v coupon is %v, want 0", year, coupon)
+		}
+		if averageReturn := interest.ReturnAt(year); averageReturn != 0 {
+			t.Errorf("year %v return is %v, want 0", year, averageReturn)
+		}
+	}
+}
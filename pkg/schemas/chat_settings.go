@@ -1,21 +1,17 @@
 package schemas
 
 import (
-	"bytes"
 	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
 	"strconv"
 	"time"
-
-	"github.com/Jason-CKY/telegram-ssbbot/pkg/utils"
 )
 
 type DatetimeWithoutTimezone time.Time
 
+const DatetimeWithoutTimezoneLayout = "2006-01-02T15:04:05"
+
 func (t DatetimeWithoutTimezone) MarshalJSON() ([]byte, error) {
-	formattedTime := time.Time(t).Format("2006-01-02T15:04:05")
+	formattedTime := time.Time(t).Format(DatetimeWithoutTimezoneLayout)
 	return json.Marshal(formattedTime)
 }
 
@@ -24,7 +20,7 @@ func (t *DatetimeWithoutTimezone) UnmarshalJSON(data []byte) error {
 	if err := json.Unmarshal(data, &timeStr); err != nil {
 		return err
 	}
-	parsedTime, err := time.Parse("2006-01-02T15:04:05", timeStr)
+	parsedTime, err := time.Parse(DatetimeWithoutTimezoneLayout, timeStr)
 	if err != nil {
 		return err
 	}
@@ -33,9 +29,15 @@ func (t *DatetimeWithoutTimezone) UnmarshalJSON(data []byte) error {
 }
 
 type ChatSettings struct {
-	ChatId                 int64                   `json:"chat_id"`
-	LastNotificationTime   DatetimeWithoutTimezone `json:"last_notification_time"`
-	LatestSSBMonthNotified int                     `json:"latest_ssb_month_notified"`
+	ChatId                     int64                   `json:"chat_id"`
+	LastNotificationTime       DatetimeWithoutTimezone `json:"last_notification_time"`
+	LatestSSBIssueNotified     string                  `json:"latest_ssb_issue_notified"`     // issue code of the last bond the chat was notified of
+	UnsubscribedReason         string                  `json:"unsubscribed_reason"`           // set when the bot can no longer reach the chat
+	ReminderDays               int                     `json:"reminder_days"`                 // days before the last day to apply to send a reminder, 0 to not remind
+	LatestSSBIssueReminded     string                  `json:"latest_ssb_issue_reminded"`     // issue code of the last bond the chat was reminded of
+	LatestSSBAllotmentNotified string                  `json:"latest_ssb_allotment_notified"` // issue code of the last bond the chat was sent allotment results of
+	PayoutNotifications        bool                    `json:"payout_notifications"`          // whether to notify the chat on the days its holdings pay coupons
+	LastPayoutNotified         string                  `json:"last_payout_notified"`          // date the chat was last checked for, and notified of, coupon payments, e.g. "2027-05-01"
 }
 
 // MarshalJSON implements the json.Marshaler interface.
@@ -74,190 +76,3 @@ func (cs *ChatSettings) UnmarshalJSON(data []byte) error {
 	cs.ChatId = chatId
 	return nil
 }
-
-func (chatSettings ChatSettings) Create() error {
-	endpoint := fmt.Sprintf("%v/items/ssbbot_chat_settings", utils.DirectusHost)
-	reqBody, _ := json.Marshal(chatSettings)
-	req, httpErr := http.NewRequest(http.MethodPost, endpoint, bytes.NewBuffer(reqBody))
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", utils.DirectusToken))
-	if httpErr != nil {
-		return httpErr
-	}
-	client := &http.Client{}
-	res, httpErr := client.Do(req)
-	if httpErr != nil {
-		return httpErr
-	}
-	body, _ := io.ReadAll(res.Body)
-	defer res.Body.Close()
-	if res.StatusCode != 200 {
-		return fmt.Errorf("error inserting chat settings to directus: %v", string(body))
-	}
-
-	return nil
-}
-
-func (chatSettings ChatSettings) Update() error {
-	endpoint := fmt.Sprintf("%v/items/ssbbot_chat_settings/%v", utils.DirectusHost, chatSettings.ChatId)
-	reqBody, _ := json.Marshal(chatSettings)
-	req, httpErr := http.NewRequest(http.MethodPatch, endpoint, bytes.NewBuffer(reqBody))
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", utils.DirectusToken))
-	if httpErr != nil {
-		return httpErr
-	}
-	client := &http.Client{}
-	res, httpErr := client.Do(req)
-	if httpErr != nil {
-		return httpErr
-	}
-	body, _ := io.ReadAll(res.Body)
-	defer res.Body.Close()
-	if res.StatusCode != 200 {
-		return fmt.Errorf("error updating chat settings to directus: %v", string(body))
-	}
-
-	return nil
-
-}
-
-func (chatSettings ChatSettings) Delete() error {
-	endpoint := fmt.Sprintf("%v/items/ssbbot_chat_settings/%v", utils.DirectusHost, chatSettings.ChatId)
-	req, httpErr := http.NewRequest(http.MethodDelete, endpoint, nil)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", utils.DirectusToken))
-	if httpErr != nil {
-		return httpErr
-	}
-	client := &http.Client{}
-	res, httpErr := client.Do(req)
-	if httpErr != nil {
-		return httpErr
-	}
-	body, _ := io.ReadAll(res.Body)
-	defer res.Body.Close()
-	if res.StatusCode != 204 {
-		return fmt.Errorf("error deleting chat settings in directus: %v", string(body))
-	}
-	return nil
-}
-
-func GetChatSettings(chatId int64) (*ChatSettings, error) {
-	endpoint := fmt.Sprintf("%v/items/ssbbot_chat_settings", utils.DirectusHost)
-	reqBody := []byte(fmt.Sprintf(`{
-		"query": {
-			"filter": {
-				"chat_id": {
-					"_eq": "%v"
-				}
-			}
-		}
-	}`, chatId))
-	req, httpErr := http.NewRequest("SEARCH", endpoint, bytes.NewBuffer(reqBody))
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", utils.DirectusToken))
-	if httpErr != nil {
-		return nil, httpErr
-	}
-	client := &http.Client{}
-	res, httpErr := client.Do(req)
-	if httpErr != nil {
-		return nil, httpErr
-	}
-	defer res.Body.Close()
-	body, _ := io.ReadAll(res.Body)
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("error getting chat settings in directus: %v", string(body))
-	}
-	var chatSettingsResponse map[string][]ChatSettings
-	jsonErr := json.Unmarshal(body, &chatSettingsResponse)
-	// error handling for json unmarshaling
-	if jsonErr != nil {
-		return nil, jsonErr
-	}
-
-	if len(chatSettingsResponse["data"]) == 0 {
-		return nil, nil
-	}
-
-	return &chatSettingsResponse["data"][0], nil
-}
-
-func InsertChatSettingsIfNotPresent(chatId int64) (*ChatSettings, bool, error) {
-	chatSettings, err := GetChatSettings(chatId)
-	if err != nil {
-		return nil, false, err
-	}
-	if chatSettings == nil {
-		localTimezone, err := time.LoadLocation("Asia/Singapore") // Look up a location by it's IANA name.
-		if err != nil {
-			panic(err)
-		}
-		chatSettings = &ChatSettings{
-			ChatId:               chatId,
-			LastNotificationTime: DatetimeWithoutTimezone(time.Now().In(localTimezone)),
-		}
-		err = chatSettings.Create()
-		if err != nil {
-			return nil, false, err
-		}
-
-		return chatSettings, false, nil
-	}
-	return chatSettings, true, nil
-}
-
-func MigrateChatSettingsChatId(fromChatId int64, toChatId int64) error {
-	oldChatSettings, err := GetChatSettings(fromChatId)
-	if err != nil {
-		return err
-	}
-	err = oldChatSettings.Delete()
-	if err != nil {
-		return err
-	}
-	oldChatSettings.ChatId = toChatId
-	err = oldChatSettings.Create()
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func GetUsersToNotify(month int) ([]ChatSettings, error) {
-	endpoint := fmt.Sprintf("%v/items/ssbbot_chat_settings", utils.DirectusHost)
-	reqBody := fmt.Appendf(nil, `{
-		"query": {
-			"filter": {
-				"latest_ssb_month_notified": {
-					"_neq": %v
-				}
-			}
-		}
-	}`, month)
-	req, httpErr := http.NewRequest("SEARCH", endpoint, bytes.NewBuffer(reqBody))
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", utils.DirectusToken))
-	if httpErr != nil {
-		return nil, httpErr
-	}
-	client := &http.Client{}
-	res, httpErr := client.Do(req)
-	if httpErr != nil {
-		return nil, httpErr
-	}
-	defer res.Body.Close()
-	body, _ := io.ReadAll(res.Body)
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("error searching for reminder in directus: %v", string(body))
-	}
-	var reminderResponse map[string][]ChatSettings
-	jsonErr := json.Unmarshal(body, &reminderResponse)
-	// error handling for json unmarshaling
-	if jsonErr != nil {
-		return nil, jsonErr
-	}
-
-	return reminderResponse["data"], nil
-}
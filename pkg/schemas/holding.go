@@ -0,0 +1,8 @@
+package schemas
+
+// Holding is the amount of one issue a chat holds, in dollars.
+type Holding struct {
+	ChatId    int64  `json:"chat_id,string"`
+	IssueCode string `json:"issue_code"`
+	Amount    int    `json:"amount"`
+}
@@ -0,0 +1,22 @@
+package schemas
+
+type OutboxStatus string
+
+const (
+	OutboxStatusPending OutboxStatus = "pending"
+	// recorded just before sending, so a send interrupted by a crash is not
+	// repeated as it may have been delivered
+	OutboxStatusInFlight OutboxStatus = "in_flight"
+	OutboxStatusSent     OutboxStatus = "sent"
+	OutboxStatusFailed   OutboxStatus = "failed"
+)
+
+// OutboxEntry is the delivery state of one issue's notification to one chat.
+type OutboxEntry struct {
+	IssueCode   string                  `json:"issue_code"`
+	ChatId      int64                   `json:"chat_id,string"`
+	Status      OutboxStatus            `json:"status"`
+	Attempts    int                     `json:"attempts"`
+	LastError   string                  `json:"last_error"`
+	UpdatedTime DatetimeWithoutTimezone `json:"updated_time"`
+}
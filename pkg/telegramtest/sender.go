@@ -0,0 +1,173 @@
+// Package telegramtest provides a fake telegram bot for exercising the handler
+// and scheduler without network access.
+package telegramtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/Jason-CKY/telegram-ssbbot/pkg/core"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// SentMessage is a Chattable the RecordingSender accepted.
+type SentMessage struct {
+	ChatID    int64
+	Chattable tgbotapi.Chattable
+	Message   tgbotapi.Message
+}
+
+// RecordingSender implements core.Sender by recording every message instead of
+// sending it. Errors set with FailChat are returned for every send to that chat.
+type RecordingSender struct {
+	mu               sync.Mutex
+	sent             []SentMessage
+	errors           map[int64]error
+	nextMessageID    int
+	nextFileID       int
+	nextMediaGroupID int
+}
+
+func NewRecordingSender() *RecordingSender {
+	return &RecordingSender{
+		errors: make(map[int64]error),
+	}
+}
+
+// FailChat makes every following send to chatID return err, or succeed again if err is nil.
+func (s *RecordingSender) FailChat(chatID int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		delete(s.errors, chatID)
+		return
+	}
+	s.errors[chatID] = err
+}
+
+// Sent returns a copy of every successfully sent message, in order.
+func (s *RecordingSender) Sent() []SentMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SentMessage(nil), s.sent...)
+}
+
+// SentTo returns the successfully sent messages to chatID, in order.
+func (s *RecordingSender) SentTo(chatID int64) []SentMessage {
+	var sent []SentMessage
+	for _, message := range s.Sent() {
+		if message.ChatID == chatID {
+			sent = append(sent, message)
+		}
+	}
+	return sent
+}
+
+// Uploads counts the sent photos, alone or in a media group, that uploaded new
+// bytes rather than reusing a file_id.
+func (s *RecordingSender) Uploads() int {
+	uploads := 0
+	for _, message := range s.Sent() {
+		switch c := message.Chattable.(type) {
+		case tgbotapi.PhotoConfig:
+			if c.File.NeedsUpload() {
+				uploads++
+			}
+		case tgbotapi.MediaGroupConfig:
+			for _, media := range c.Media {
+				if photo, ok := media.(tgbotapi.InputMediaPhoto); ok && photo.Media.NeedsUpload() {
+					uploads++
+				}
+			}
+		}
+	}
+	return uploads
+}
+
+// fileID returns the file_id telegram would give file, a new one if it is uploaded.
+// It must be called with s.mu held.
+func (s *RecordingSender) fileID(file tgbotapi.RequestFileData) string {
+	if !file.NeedsUpload() {
+		return file.SendData()
+	}
+	s.nextFileID++
+	return fmt.Sprintf("file-%v", s.nextFileID)
+}
+
+func (s *RecordingSender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chatID, ok := core.ChatIDOf(c)
+	if !ok {
+		return tgbotapi.Message{}, fmt.Errorf("recording sender does not support %T", c)
+	}
+	if err, ok := s.errors[chatID]; ok {
+		return tgbotapi.Message{}, err
+	}
+
+	s.nextMessageID++
+	message := tgbotapi.Message{
+		MessageID: s.nextMessageID,
+		Chat:      &tgbotapi.Chat{ID: chatID},
+	}
+	switch c := c.(type) {
+	case tgbotapi.MessageConfig:
+		message.Text = c.Text
+	case tgbotapi.PhotoConfig:
+		message.Caption = c.Caption
+		message.Photo = []tgbotapi.PhotoSize{{FileID: s.fileID(c.File)}}
+	}
+	s.sent = append(s.sent, SentMessage{ChatID: chatID, Chattable: c, Message: message})
+	return message, nil
+}
+
+// Request records c like Send. A media group is answered with a message per
+// photo in the group, as telegram does.
+func (s *RecordingSender) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	if mediaGroup, ok := c.(tgbotapi.MediaGroupConfig); ok {
+		messages, err := s.sendMediaGroup(mediaGroup)
+		if err != nil {
+			return nil, err
+		}
+		result, err := json.Marshal(messages)
+		if err != nil {
+			return nil, err
+		}
+		return &tgbotapi.APIResponse{Ok: true, Result: result}, nil
+	}
+	if _, err := s.Send(c); err != nil {
+		return nil, err
+	}
+	return &tgbotapi.APIResponse{Ok: true}, nil
+}
+
+// sendMediaGroup records a media group as one SentMessage holding its first message.
+func (s *RecordingSender) sendMediaGroup(c tgbotapi.MediaGroupConfig) ([]tgbotapi.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err, ok := s.errors[c.ChatID]; ok {
+		return nil, err
+	}
+
+	s.nextMediaGroupID++
+	messages := make([]tgbotapi.Message, 0, len(c.Media))
+	for _, media := range c.Media {
+		photo, ok := media.(tgbotapi.InputMediaPhoto)
+		if !ok {
+			return nil, fmt.Errorf("recording sender does not support %T in a media group", media)
+		}
+		s.nextMessageID++
+		messages = append(messages, tgbotapi.Message{
+			MessageID:    s.nextMessageID,
+			Chat:         &tgbotapi.Chat{ID: c.ChatID},
+			MediaGroupID: fmt.Sprintf("group-%v", s.nextMediaGroupID),
+			Caption:      photo.Caption,
+			Photo:        []tgbotapi.PhotoSize{{FileID: s.fileID(photo.Media)}},
+		})
+	}
+	if len(messages) > 0 {
+		s.sent = append(s.sent, SentMessage{ChatID: c.ChatID, Chattable: c, Message: messages[0]})
+	}
+	return messages, nil
+}
@@ -2,14 +2,58 @@ package utils
 
 var (
 	LogLevel             string
+	StorageBackend       string
+	SQLitePath           string
 	DirectusHost         string
 	DirectusToken        string
 	BotToken             string
 	WhitelistedUsernames []string
+	MASBaseURL           string
+	MASUserAgent         string
+	MASTimeout           int // in seconds
+	MASCacheTTL          int // in minutes
+	BroadcastWorkers     int
+	TelegramGlobalRate   int // messages per second
+	TelegramGroupRate    int // messages per minute to the same group
+	ShutdownTimeout      int // in seconds
+	ScheduleFile         string
+	AnnouncementSchedule string
+	MaintenanceSchedule  string
+	ReminderSchedule     string
+	AllotmentSchedule    string
+	PayoutSchedule       string
+	HealthListenAddr     string
+	NotifyCouponCurve    bool
+	UpdateMode           string
+	WebhookURL           string
+	WebhookListenAddr    string
+	WebhookSecretToken   string
 )
 
 const HELP_MESSAGE string = `This bot updates you on the singapore savings bonds interest rates! The following commands are available:
 /subscribe adds you into the monthly ssb interest rate updates
 /unsubscribe removes you from the monthly ssb interest rate updates
+/remind <days> reminds you the given number of days before applications close, /remind off to stop
+/hold add <issue code> <amount> records savings bonds you hold, e.g. /hold add SBJAN25 5000
+/hold remove <issue code> [amount] removes some or all of a holding
+/hold list lists your holdings with their projected interest
+/calendar lists the coupon payments of your holdings in the next 12 months
+/calendar notify on|off notifies you on the days your holdings pay coupons
+/redeem <issue code> <amount> <month> works out redeeming a holding, e.g. /redeem SBJAN25 10000 2027-03
+/switch <issue code> [amount] compares keeping a holding against switching it to the next issue
+/curve [issue code] charts the coupons of an issue by year against the issue before it, the latest issue by default
 `
 const DEFAULT_TIMEZONE = "Asia/Singapore"
+const DEFAULT_MAS_BASE_URL = "https://eservices.mas.gov.sg/statistics/api/v1/bondsandbills/m"
+const DEFAULT_MAS_USER_AGENT = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:135.0) Gecko/20100101 Firefox/135.0"
+
+const (
+	UPDATE_MODE_POLLING = "polling"
+	UPDATE_MODE_WEBHOOK = "webhook"
+)
+
+const (
+	STORAGE_BACKEND_DIRECTUS = "directus"
+	STORAGE_BACKEND_SQLITE   = "sqlite"
+	STORAGE_BACKEND_MEMORY   = "memory"
+)
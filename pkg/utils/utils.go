@@ -36,6 +36,33 @@ func LookupEnvString(key string) string {
 	return envVariable
 }
 
+func LookupEnvStringDefault(key string, defaultValue string) string {
+	envVariable, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	return envVariable
+}
+
+func LookupEnvIntDefault(key string, defaultValue int) int {
+	if _, exists := os.LookupEnv(key); !exists {
+		return defaultValue
+	}
+	return LookupEnvInt(key)
+}
+
+func LookupEnvBoolDefault(key string, defaultValue bool) bool {
+	envVariable, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	value, err := strconv.ParseBool(envVariable)
+	if err != nil {
+		panic(err.Error())
+	}
+	return value
+}
+
 func LookupEnvInt(key string) int {
 	envVariable, exists := os.LookupEnv(key)
 	if !exists {
@@ -26,3 +26,49 @@ curl -X POST -H "Content-Type: application/json" \
     -d '{"type":"integer","meta":{"interface":"input","special":null},"field":"latest_ssb_month_notified"}' \
     $DIRECTUS_URL/fields/ssbbot_chat_settings
 
+curl -X POST -H "Content-Type: application/json" \
+    -H "Authorization: Bearer $ADMIN_ACCESS_TOKEN" \
+    -d '{"type":"string","meta":{"interface":"input","special":null},"field":"latest_ssb_issue_notified"}' \
+    $DIRECTUS_URL/fields/ssbbot_chat_settings
+
+curl -X POST -H "Content-Type: application/json" \
+    -H "Authorization: Bearer $ADMIN_ACCESS_TOKEN" \
+    -d '{"type":"string","meta":{"interface":"input","special":null},"field":"unsubscribed_reason"}' \
+    $DIRECTUS_URL/fields/ssbbot_chat_settings
+
+curl -X POST -H "Content-Type: application/json" \
+    -H "Authorization: Bearer $ADMIN_ACCESS_TOKEN" \
+    -d '{"type":"integer","meta":{"interface":"input","special":null},"field":"reminder_days","schema":{"default_value":0}}' \
+    $DIRECTUS_URL/fields/ssbbot_chat_settings
+
+curl -X POST -H "Content-Type: application/json" \
+    -H "Authorization: Bearer $ADMIN_ACCESS_TOKEN" \
+    -d '{"type":"string","meta":{"interface":"input","special":null},"field":"latest_ssb_issue_reminded"}' \
+    $DIRECTUS_URL/fields/ssbbot_chat_settings
+
+curl -X POST -H "Content-Type: application/json" \
+    -H "Authorization: Bearer $ADMIN_ACCESS_TOKEN" \
+    -d '{"type":"string","meta":{"interface":"input","special":null},"field":"latest_ssb_allotment_notified"}' \
+    $DIRECTUS_URL/fields/ssbbot_chat_settings
+
+curl -X POST -H "Content-Type: application/json" \
+    -H "Authorization: Bearer $ADMIN_ACCESS_TOKEN" \
+    -d '{"type":"boolean","meta":{"interface":"boolean","special":["cast-boolean"]},"field":"payout_notifications","schema":{"default_value":false}}' \
+    $DIRECTUS_URL/fields/ssbbot_chat_settings
+
+curl -X POST -H "Content-Type: application/json" \
+    -H "Authorization: Bearer $ADMIN_ACCESS_TOKEN" \
+    -d '{"type":"string","meta":{"interface":"input","special":null},"field":"last_payout_notified"}' \
+    $DIRECTUS_URL/fields/ssbbot_chat_settings
+
+# ssbbot_notification_outbox table
+curl -X POST -H "Content-Type: application/json" \
+    -H "Authorization: Bearer $ADMIN_ACCESS_TOKEN" \
+    -d '{"collection":"ssbbot_notification_outbox","fields":[{"field":"id","type":"integer","meta":{"hidden":true,"interface":"input","readonly":true},"schema":{"is_primary_key":true,"has_auto_increment":true}},{"field":"issue_code","type":"string","meta":{"interface":"input"},"schema":{"is_nullable":false}},{"field":"chat_id","type":"string","meta":{"interface":"input"},"schema":{"is_nullable":false}},{"field":"status","type":"string","meta":{"interface":"input"},"schema":{"is_nullable":false}},{"field":"attempts","type":"integer","meta":{"interface":"input"},"schema":{"default_value":0}},{"field":"last_error","type":"text","meta":{"interface":"input-multiline"},"schema":{}},{"field":"updated_time","type":"dateTime","meta":{"interface":"datetime"},"schema":{}}],"schema":{},"meta":{"singleton":false}}' \
+    $DIRECTUS_URL/collections
+
+# ssbbot_holdings table
+curl -X POST -H "Content-Type: application/json" \
+    -H "Authorization: Bearer $ADMIN_ACCESS_TOKEN" \
+    -d '{"collection":"ssbbot_holdings","fields":[{"field":"id","type":"integer","meta":{"hidden":true,"interface":"input","readonly":true},"schema":{"is_primary_key":true,"has_auto_increment":true}},{"field":"chat_id","type":"string","meta":{"interface":"input"},"schema":{"is_nullable":false}},{"field":"issue_code","type":"string","meta":{"interface":"input"},"schema":{"is_nullable":false}},{"field":"amount","type":"integer","meta":{"interface":"input"},"schema":{"is_nullable":false}}],"schema":{},"meta":{"singleton":false}}' \
+    $DIRECTUS_URL/collections
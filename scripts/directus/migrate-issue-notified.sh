@@ -0,0 +1,20 @@
+# Fills latest_ssb_issue_notified of chats notified before issue codes were
+# recorded, so they are not notified of the current issue again after upgrading.
+# Run once before starting the upgraded bot, with the issue code and issue month
+# of the latest issue chats were notified of, e.g.
+#   ISSUE_CODE=<issue code> ISSUE_MONTH=11 sh scripts/directus/migrate-issue-notified.sh
+if [ -z "$ISSUE_CODE" ] || [ -z "$ISSUE_MONTH" ]; then
+    echo "ISSUE_CODE and ISSUE_MONTH must be set" >&2
+    exit 1
+fi
+
+# the month was recorded as 13 for january issues, notified in december
+LEGACY_MONTHS=$ISSUE_MONTH
+if [ "$ISSUE_MONTH" -eq 1 ]; then
+    LEGACY_MONTHS="1,13"
+fi
+
+curl -X PATCH -H "Content-Type: application/json" \
+    -H "Authorization: Bearer $ADMIN_ACCESS_TOKEN" \
+    -d "{\"query\":{\"filter\":{\"_and\":[{\"latest_ssb_month_notified\":{\"_in\":[$LEGACY_MONTHS]}},{\"_or\":[{\"latest_ssb_issue_notified\":{\"_null\":true}},{\"latest_ssb_issue_notified\":{\"_empty\":true}}]}]},\"limit\":-1},\"data\":{\"latest_ssb_issue_notified\":\"$ISSUE_CODE\"}}" \
+    $DIRECTUS_URL/items/ssbbot_chat_settings
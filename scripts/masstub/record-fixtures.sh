@@ -0,0 +1,19 @@
+# Records the last 24 issues from the MAS api into the masstub fixtures.
+# Run from the repository root: sh scripts/masstub/record-fixtures.sh
+MAS_BASE_URL=${MAS_BASE_URL:-https://eservices.mas.gov.sg/statistics/api/v1/bondsandbills/m}
+MAS_USER_AGENT=${MAS_USER_AGENT:-"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:135.0) Gecko/20100101 Firefox/135.0"}
+FIXTURES_DIR=pkg/masstub/fixtures
+
+curl -sSf -G -A "$MAS_USER_AGENT" \
+    --data-urlencode "rows=24" \
+    --data-urlencode "sort=issue_date desc" \
+    $MAS_BASE_URL/listsavingbonds \
+    | jq . > $FIXTURES_DIR/listsavingbonds.json || exit 1
+
+ISSUE_CODES=$(jq -r '[.result.records[].issue_code] | join(" OR ")' $FIXTURES_DIR/listsavingbonds.json)
+
+curl -sSf -G -A "$MAS_USER_AGENT" \
+    --data-urlencode "rows=24" \
+    --data-urlencode "filters=issue_code:($ISSUE_CODES)" \
+    $MAS_BASE_URL/savingbondsinterest \
+    | jq . > $FIXTURES_DIR/savingbondsinterest.json || exit 1